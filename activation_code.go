@@ -0,0 +1,217 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/KilimcininKorOglu/euicc-go/lpa"
+)
+
+// ActivationCodeResponse is an activation code split into its fields (SGP.22 section 4.1)
+type ActivationCodeResponse struct {
+	Code                     string   `json:"activation_code"`
+	Format                   string   `json:"format"`
+	SMDPAddress              string   `json:"smdp_address"`
+	MatchingID               string   `json:"matching_id"`
+	OID                      string   `json:"oid,omitempty"`
+	ConfirmationCodeRequired bool     `json:"confirmation_code_required"`
+	Warnings                 []string `json:"warnings,omitempty"`
+}
+
+var (
+	hostLabelPattern  = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?$`)
+	oidPattern        = regexp.MustCompile(`^[0-9]+(\.[0-9]+)+$`)
+	matchingIDPattern = regexp.MustCompile(`^[0-9A-Z-]*$`)
+)
+
+// activationCodeFields names the $-separated fields for error messages
+var activationCodeFields = []string{"format", "SM-DP+ address", "matching ID", "SM-DP+ OID", "confirmation code flag"}
+
+// handleParseCode validates an activation code offline and prints its fields
+func handleParseCode(args []string) (interface{}, error) {
+	parseFlags := flag.NewFlagSet("parse-code", flag.ContinueOnError)
+	qrImage := parseFlags.String("qr", "", "Read the activation code from a PNG or JPEG image of its QR code")
+	if err := parseFlags.Parse(args); err != nil {
+		return nil, markError(errInvalidFlag, err)
+	}
+
+	var code string
+	switch {
+	case *qrImage != "" && parseFlags.NArg() > 0:
+		return nil, fmt.Errorf("%w -qr: give either a code or --qr", errInvalidFlag)
+	case *qrImage != "":
+		text, err := decodeQRFile(*qrImage)
+		if err != nil {
+			return nil, err
+		}
+		code = text
+	case parseFlags.NArg() == 1:
+		code = parseFlags.Arg(0)
+	case parseFlags.NArg() > 1:
+		return nil, fmt.Errorf("%w: parse-code '<activation code>' (quote the code, the shell expands $)", errUsage)
+	default:
+		return nil, fmt.Errorf("%w: parse-code '<activation code>' or parse-code --qr <image>", errUsage)
+	}
+
+	parsed, err := parseActivationCode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	// The library must accept what the download command will pass to it
+	ac := &lpa.ActivationCode{}
+	if err := ac.UnmarshalText([]byte(parsed.Code)); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidActivationCode, err)
+	}
+	return parsed, nil
+}
+
+// parseActivationCode checks an activation code against SGP.22 and returns its fields.
+// Surrounding whitespace and a missing LPA: prefix are tolerated and reported as warnings,
+// the normalised code is returned in Code.
+func parseActivationCode(input string) (*ActivationCodeResponse, error) {
+	result := &ActivationCodeResponse{}
+
+	code := strings.TrimSpace(input)
+	if code != input {
+		result.Warnings = append(result.Warnings, "surrounding whitespace removed")
+	}
+	if code == "" {
+		return nil, fmt.Errorf("%w: empty", errInvalidActivationCode)
+	}
+	// Columns in errors refer to the code as it was given
+	offset := strings.Index(input, code)
+
+	if len(code) >= 4 && strings.EqualFold(code[:4], "LPA:") {
+		code, offset = code[4:], offset+4
+	} else {
+		result.Warnings = append(result.Warnings, "LPA: prefix missing")
+	}
+
+	for i, r := range code {
+		if unicode.IsSpace(r) {
+			return nil, fmt.Errorf("%w: whitespace at column %d, codes contain no spaces", errInvalidActivationCode, offset+i+1)
+		}
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return nil, fmt.Errorf("%w: character %q at column %d is not printable ASCII", errInvalidActivationCode, r, offset+i+1)
+		}
+	}
+
+	fields := strings.Split(code, "$")
+	if len(fields) > len(activationCodeFields) {
+		return nil, fmt.Errorf("%w: %d $-separated fields, at most %d allowed (format$SM-DP+$matching ID$OID$flag)",
+			errInvalidActivationCode, len(fields), len(activationCodeFields))
+	}
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("%w: %d $-separated fields, at least 3 required (1$SM-DP+ address$matching ID)", errInvalidActivationCode, len(fields))
+	}
+
+	// fieldError reports a problem with field i, pointing at the column where it starts
+	fieldError := func(i int, format string, args ...interface{}) error {
+		column := offset + len(strings.Join(fields[:i], "$")) + 1
+		if i > 0 {
+			column++
+		}
+		return fmt.Errorf("%w: %s at column %d: %s", errInvalidActivationCode, activationCodeFields[i], column, fmt.Sprintf(format, args...))
+	}
+
+	result.Format = fields[0]
+	if result.Format != "1" {
+		return nil, fieldError(0, "%q is not supported, only 1", result.Format)
+	}
+
+	result.SMDPAddress = fields[1]
+	if err := validateSMDPAddress(result.SMDPAddress); err != nil {
+		return nil, fieldError(1, "%v", err)
+	}
+
+	result.MatchingID = fields[2]
+	if !matchingIDPattern.MatchString(result.MatchingID) {
+		if !matchingIDPattern.MatchString(strings.ToUpper(result.MatchingID)) {
+			return nil, fieldError(2, "only A-Z, 0-9 and - are allowed")
+		}
+		result.Warnings = append(result.Warnings, "matching ID contains lower case letters, SGP.22 allows upper case only")
+	}
+
+	if len(fields) > 3 {
+		result.OID = fields[3]
+		if result.OID != "" && !oidPattern.MatchString(result.OID) {
+			return nil, fieldError(3, "%q is not a dotted object identifier", result.OID)
+		}
+	}
+	if len(fields) > 4 {
+		if fields[4] != "1" {
+			return nil, fieldError(4, "%q is not allowed, only 1", fields[4])
+		}
+		result.ConfirmationCodeRequired = true
+	}
+
+	result.Code = "LPA:" + strings.Join(fields, "$")
+	return result, nil
+}
+
+// prepareActivationCode checks a code for download no more strictly than the library does.
+// A code that parseActivationCode refuses, such as one with an underscore in the host name or
+// a bracketed IPv6 address, is passed on as given; parse-code names what SGP.22 does not allow.
+// It returns the SM-DP+ address for reports.
+func prepareActivationCode(input string) (*lpa.ActivationCode, string, error) {
+	code := input
+	parsed, err := parseActivationCode(input)
+	if err == nil {
+		code = parsed.Code
+	}
+	if *verbose {
+		if err != nil {
+			log.Printf("Activation code: %v, passing it on as given\n", err)
+		} else {
+			for _, warning := range parsed.Warnings {
+				log.Printf("Activation code: %s\n", warning)
+			}
+		}
+	}
+
+	ac := &lpa.ActivationCode{}
+	if err := ac.UnmarshalText([]byte(code)); err != nil {
+		return nil, "", fmt.Errorf("%w: %w", errInvalidActivationCode, err)
+	}
+	if parsed != nil {
+		return ac, parsed.SMDPAddress, nil
+	}
+	return ac, ac.SMDP.String(), nil
+}
+
+// validateSMDPAddress checks that an SM-DP+ address is a host name with an optional port
+func validateSMDPAddress(address string) error {
+	if address == "" {
+		return errors.New("empty")
+	}
+	if strings.Contains(address, "://") || strings.Contains(address, "/") {
+		return errors.New("must be a host name, not a URL")
+	}
+
+	host := address
+	if i := strings.LastIndex(address, ":"); i >= 0 {
+		host = address[:i]
+		port := address[i+1:]
+		if port == "" || strings.Trim(port, "0123456789") != "" || len(port) > 5 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+	}
+	if len(host) > 253 {
+		return errors.New("host name too long")
+	}
+	for _, label := range strings.Split(host, ".") {
+		if len(label) > 63 || !hostLabelPattern.MatchString(label) {
+			return fmt.Errorf("%q is not a valid host name", host)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KilimcininKorOglu/euicc-go/apdu"
+)
+
+// traceMinSecretLen avoids masking short values that would match unrelated bytes
+const traceMinSecretLen = 4
+
+// traceSecrets holds values registered by commands that are masked in APDU traces
+var (
+	traceSecretsMu sync.Mutex
+	traceSecrets   [][]byte
+)
+
+// redactInTrace registers values (matching IDs, confirmation codes) to be masked in APDU traces
+func redactInTrace(values ...string) {
+	traceSecretsMu.Lock()
+	defer traceSecretsMu.Unlock()
+	for _, v := range values {
+		if len(v) >= traceMinSecretLen {
+			traceSecrets = append(traceSecrets, []byte(v))
+		}
+	}
+}
+
+// tracedAPDU is one C-APDU/R-APDU pair
+type tracedAPDU struct {
+	at       time.Time
+	elapsed  time.Duration
+	command  []byte
+	response []byte
+	err      error
+}
+
+// tracingChannel logs every APDU exchanged on the wrapped channel.
+// APDUs belonging to one ES10 command (STORE DATA blocks and GET RESPONSE chains)
+// are logged together once complete, so sensitive values split across blocks can be masked.
+type tracingChannel struct {
+	channel apdu.SmartCardChannel
+	logger  *log.Logger
+	closer  io.Closer
+	pending []tracedAPDU
+}
+
+// newTracingChannel wraps a channel and logs its APDUs to path, or stderr if path is empty
+func newTracingChannel(channel apdu.SmartCardChannel, path string) (apdu.SmartCardChannel, error) {
+	t := &tracingChannel{channel: channel}
+	var out io.Writer = os.Stderr
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidTraceFile, err)
+		}
+		out, t.closer = file, file
+	}
+	t.logger = log.New(out, "", 0)
+	return t, nil
+}
+
+// log writes one trace line prefixed with the time the operation started
+func (t *tracingChannel) log(at time.Time, format string, args ...interface{}) {
+	t.logger.Printf("%s APDU "+format, append([]interface{}{at.UTC().Format(time.RFC3339Nano)}, args...)...)
+}
+
+func (t *tracingChannel) Connect() error {
+	start := time.Now()
+	err := t.channel.Connect()
+	t.log(start, "connect time=%s%s", time.Since(start), traceErrorSuffix(err))
+	return err
+}
+
+func (t *tracingChannel) Disconnect() error {
+	t.flush()
+	start := time.Now()
+	err := t.channel.Disconnect()
+	t.log(start, "disconnect%s", traceErrorSuffix(err))
+	if t.closer != nil {
+		t.closer.Close()
+	}
+	return err
+}
+
+func (t *tracingChannel) OpenLogicalChannel(aid []byte) (byte, error) {
+	start := time.Now()
+	channel, err := t.channel.OpenLogicalChannel(aid)
+	t.log(start, "ch=%d open AID=%X time=%s%s", channel, aid, time.Since(start), traceErrorSuffix(err))
+	return channel, err
+}
+
+func (t *tracingChannel) CloseLogicalChannel(channel byte) error {
+	t.flush()
+	start := time.Now()
+	err := t.channel.CloseLogicalChannel(channel)
+	t.log(start, "ch=%d close%s", channel, traceErrorSuffix(err))
+	return err
+}
+
+func (t *tracingChannel) Transmit(command []byte) ([]byte, error) {
+	start := time.Now()
+	response, err := t.channel.Transmit(command)
+	t.pending = append(t.pending, tracedAPDU{
+		at:       start,
+		elapsed:  time.Since(start),
+		command:  command,
+		response: response,
+		err:      err,
+	})
+	// Wait for the rest of a segmented command or a response chain
+	if exchangeComplete(command, response, err) {
+		t.flush()
+	}
+	return response, err
+}
+
+// flush masks sensitive values in the pending APDUs and logs them
+func (t *tracingChannel) flush() {
+	commands, responses := maskExchange(t.pending)
+	for i, p := range t.pending {
+		r, sw := "", ""
+		if len(p.response) >= 2 {
+			r, sw = responses[i][:len(responses[i])-4], fmt.Sprintf(" sw=%X", p.response[len(p.response)-2:])
+		}
+		t.log(p.at, "ch=%d%s time=%s C=%s R=%s%s",
+			logicalChannel(p.command), sw, p.elapsed, commands[i], r, traceErrorSuffix(p.err))
+	}
+	t.pending = nil
+}
+
+// exchangeComplete reports whether an APDU ends an ES10 command,
+// i.e. it is not followed by further STORE DATA blocks or a GET RESPONSE chain
+func exchangeComplete(command, response []byte, err error) bool {
+	moreBlocks := len(command) > 2 && command[1] == 0xE2 && command[2]&0x80 == 0
+	moreData := len(response) >= 2 && response[len(response)-2] == 0x61
+	return err != nil || !(moreBlocks || moreData)
+}
+
+// maskExchange hex-encodes the APDUs of one ES10 command, replacing sensitive bytes with **.
+// The status words of the responses are kept.
+func maskExchange(exchange []tracedAPDU) (commands, responses []string) {
+	// Reassemble the command and response payloads to find sensitive values
+	var commandData, responseData []byte
+	for _, p := range exchange {
+		data, _ := apduCommandData(p.command)
+		commandData = append(commandData, data...)
+		if len(p.response) >= 2 {
+			responseData = append(responseData, p.response[:len(p.response)-2]...)
+		}
+	}
+
+	traceSecretsMu.Lock()
+	secrets := append([][]byte(nil), traceSecrets...)
+	traceSecretsMu.Unlock()
+	secrets = append(secrets, sensitiveTLVValues(commandData)...)
+	secrets = append(secrets, sensitiveTLVValues(responseData)...)
+
+	commandMask := secretMask(commandData, secrets)
+	responseMask := secretMask(responseData, secrets)
+
+	var commandOffset, responseOffset int
+	for _, p := range exchange {
+		data, offset := apduCommandData(p.command)
+		commands = append(commands, maskedHex(p.command, offset, commandMask[commandOffset:commandOffset+len(data)]))
+		commandOffset += len(data)
+
+		r := fmt.Sprintf("%X", p.response)
+		if len(p.response) >= 2 {
+			body := len(p.response) - 2
+			r = maskedHex(p.response, 0, responseMask[responseOffset:responseOffset+body])
+			responseOffset += body
+		}
+		responses = append(responses, r)
+	}
+	return commands, responses
+}
+
+// apduCommandData returns the data field of a command APDU (short or extended Lc) and its offset
+func apduCommandData(command []byte) ([]byte, int) {
+	switch {
+	case len(command) > 7 && command[4] == 0x00:
+		length := int(command[5])<<8 | int(command[6])
+		if 7+length <= len(command) {
+			return command[7 : 7+length], 7
+		}
+	case len(command) > 5:
+		length := int(command[4])
+		if 5+length <= len(command) {
+			return command[5 : 5+length], 5
+		}
+	}
+	return nil, len(command)
+}
+
+// logicalChannel decodes the logical channel number from the class byte (ISO 7816-4)
+func logicalChannel(command []byte) int {
+	if len(command) == 0 {
+		return 0
+	}
+	cla := command[0]
+	if cla&0x40 != 0 {
+		return 4 + int(cla&0x0F)
+	}
+	return int(cla & 0x03)
+}
+
+// sensitiveTLVValues returns values that must not appear in traces:
+// matchingId of CtxParamsForCommonAuthentication (AuthenticateServer) and hashCc (PrepareDownload)
+func sensitiveTLVValues(data []byte) [][]byte {
+	root, _, err := parseTLV(data)
+	if err != nil {
+		return nil
+	}
+
+	var values [][]byte
+	if root.tag == 0xBF21 {
+		if hashCc := root.find(0x04); hashCc != nil {
+			values = append(values, hashCc.value)
+		}
+	}
+
+	var walk func(t *tlv)
+	walk = func(t *tlv) {
+		if t.tag == 0xA0 && t.find(0xA1) != nil {
+			if matchingID := t.find(0x80); matchingID != nil && len(matchingID.value) > 0 {
+				values = append(values, matchingID.value)
+			}
+		}
+		for _, child := range t.children {
+			walk(child)
+		}
+	}
+	walk(root)
+	return values
+}
+
+// secretMask marks every byte of data covered by an occurrence of a secret
+func secretMask(data []byte, secrets [][]byte) []bool {
+	mask := make([]bool, len(data))
+	for _, secret := range secrets {
+		if len(secret) == 0 {
+			continue
+		}
+		for start := 0; start < len(data); {
+			i := bytes.Index(data[start:], secret)
+			if i < 0 {
+				break
+			}
+			for j := start + i; j < start+i+len(secret); j++ {
+				mask[j] = true
+			}
+			start += i + 1
+		}
+	}
+	return mask
+}
+
+// maskedHex hex-encodes b, replacing masked bytes of the data part (starting at offset) with **
+func maskedHex(b []byte, offset int, mask []bool) string {
+	var sb strings.Builder
+	for i, v := range b {
+		if i >= offset && i-offset < len(mask) && mask[i-offset] {
+			sb.WriteString("**")
+			continue
+		}
+		fmt.Fprintf(&sb, "%02X", v)
+	}
+	return sb.String()
+}
+
+func traceErrorSuffix(err error) string {
+	if err != nil {
+		return fmt.Sprintf(" error=%q", err.Error())
+	}
+	return ""
+}
@@ -0,0 +1,294 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/KilimcininKorOglu/euicc-go/lpa"
+	sgp22 "github.com/KilimcininKorOglu/euicc-go/v2"
+)
+
+// BatchEntry is one profile in a download-batch manifest
+type BatchEntry struct {
+	ActivationCode   string `json:"activation_code"`
+	ConfirmationCode string `json:"confirmation_code,omitempty"`
+	IMEI             string `json:"imei,omitempty"`
+	Nickname         string `json:"nickname,omitempty"`
+	Enable           bool   `json:"enable,omitempty"`
+}
+
+// BatchEntryResult is the outcome of one manifest entry
+type BatchEntryResult struct {
+	Index            int     `json:"index"`
+	Status           string  `json:"status"` // installed, failed or skipped
+	SMDPAddress      string  `json:"smdp_address,omitempty"`
+	ICCID            string  `json:"iccid,omitempty"`
+	ISDPAID          string  `json:"isdp_aid,omitempty"`
+	Nickname         string  `json:"nickname,omitempty"`
+	Enabled          bool    `json:"enabled,omitempty"`
+	FreeMemoryBefore *uint32 `json:"free_memory_before,omitempty"`
+	FreeMemoryAfter  *uint32 `json:"free_memory_after,omitempty"`
+	Error            string  `json:"error,omitempty"`
+	Code             string  `json:"code,omitempty"`
+	Category         string  `json:"category,omitempty"`
+}
+
+// BatchResponse is the report of a download-batch run
+type BatchResponse struct {
+	Message   string             `json:"message"`
+	Total     int                `json:"total"`
+	Installed int                `json:"installed"`
+	Failed    int                `json:"failed"`
+	Skipped   int                `json:"skipped"`
+	Results   []BatchEntryResult `json:"results"`
+}
+
+// handleDownloadBatch installs the profiles of a JSON or CSV manifest one after another
+func handleDownloadBatch(client *lpa.Client, args []string) (interface{}, error) {
+	batchFlags := flag.NewFlagSet("download-batch", flag.ContinueOnError)
+	continueOnError := batchFlags.Bool("continue-on-error", false, "Continue with the next entry when one fails")
+	minFreeMemory := batchFlags.Uint("min-free-memory", 0, "Free eUICC memory in bytes required before each install")
+	autoConfirm := batchFlags.Bool("confirm", false, "Confirm every download without prompting")
+	if err := batchFlags.Parse(args); err != nil {
+		return nil, markError(errInvalidFlag, err)
+	}
+	if batchFlags.NArg() != 1 {
+		return nil, fmt.Errorf("%w: download-batch [--confirm] [--continue-on-error] [--min-free-memory bytes] <manifest.json|csv>", errUsage)
+	}
+	if !standalone {
+		return nil, fmt.Errorf("download-batch is %w, the manifest is a local file", errNotOverAPI)
+	}
+
+	entries, err := readBatchManifest(batchFlags.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the whole manifest before the first download
+	enableIndex := -1
+	results := make([]BatchEntryResult, len(entries))
+	for i, entry := range entries {
+		_, smdpAddress, err := prepareActivationCode(entry.ActivationCode)
+		if err != nil {
+			return nil, fmt.Errorf("manifest entry %d: %w", i+1, err)
+		}
+		if entry.Enable {
+			if enableIndex >= 0 {
+				return nil, fmt.Errorf("%w: entries %d and %d both set enable, only one profile can be enabled", errInvalidManifest, enableIndex+1, i+1)
+			}
+			enableIndex = i
+		}
+		results[i] = BatchEntryResult{Index: i + 1, Status: "skipped", SMDPAddress: smdpAddress}
+	}
+
+	// The largest install so far is the estimate of what the next one needs
+	var largestInstall uint32
+	stopped := false
+	for i, entry := range entries {
+		if stopped {
+			break
+		}
+		result := &results[i]
+		if *verbose {
+			log.Printf("Batch entry %d/%d: %s\n", i+1, len(entries), result.SMDPAddress)
+		}
+
+		before, memoryKnown := freeMemory(client)
+		if memoryKnown {
+			result.FreeMemoryBefore = &before
+			required := max(uint32(*minFreeMemory), largestInstall)
+			if before < required {
+				result.setError(&commandError{
+					category: categoryCard,
+					code:     "insufficient_memory",
+					err:      fmt.Errorf("%d bytes free on the eUICC, %d required", before, required),
+				})
+				stopped = !*continueOnError
+				continue
+			}
+		}
+
+		if err := installBatchEntry(client, entry, *autoConfirm, result); err != nil {
+			result.setError(err)
+			stopped = !*continueOnError
+			continue
+		}
+
+		if after, ok := freeMemory(client); ok {
+			result.FreeMemoryAfter = &after
+			if memoryKnown && before > after {
+				largestInstall = max(largestInstall, before-after)
+			}
+		}
+	}
+
+	// Enabling refreshes the eUICC, so it is left until every profile is installed
+	if enableIndex >= 0 && results[enableIndex].Status == "installed" {
+		result := &results[enableIndex]
+		iccid, err := sgp22.NewICCID(result.ICCID)
+		if err != nil {
+			err = markError(errInvalidICCID, err)
+		} else {
+			err = cardError(client.EnableProfile(iccid, true))
+		}
+		if err != nil {
+			result.setError(fmt.Errorf("installed but not enabled: %w", err))
+		} else {
+			result.Enabled = true
+		}
+	}
+
+	response := BatchResponse{Message: "batch download completed", Total: len(entries), Results: results}
+	for _, r := range results {
+		switch r.Status {
+		case "installed":
+			response.Installed++
+		case "failed":
+			response.Failed++
+		default:
+			response.Skipped++
+		}
+	}
+	if stopped {
+		response.Message = "batch download stopped after a failure (use --continue-on-error to go on)"
+	}
+	return response, nil
+}
+
+// installBatchEntry downloads one profile and sets its nickname
+func installBatchEntry(client *lpa.Client, entry BatchEntry, confirm bool, result *BatchEntryResult) error {
+	dr, err := downloadProfile(client, downloadRequest{
+		activationCode:   entry.ActivationCode,
+		confirmationCode: entry.ConfirmationCode,
+		imei:             entry.IMEI,
+		confirm:          confirm,
+	})
+	if err != nil {
+		return err
+	}
+	result.Status = "installed"
+	result.ISDPAID = dr.ISDPAID
+
+	// Enabling waits for the end of the batch
+	err = finishDownload(client, &dr, postDownload{nickname: entry.Nickname})
+	result.ICCID = dr.ICCID
+	if err != nil {
+		return err
+	}
+	result.Nickname = entry.Nickname
+	return nil
+}
+
+// freeMemory returns the free non-volatile memory of the eUICC, if it reports it
+func freeMemory(client *lpa.Client) (uint32, bool) {
+	chipInfo, err := client.ChipInfo()
+	if err != nil || chipInfo.Info2 == nil {
+		if *verbose {
+			log.Printf("Free memory unknown: %v\n", err)
+		}
+		return 0, false
+	}
+	return chipInfo.Info2.ExtCardResource.FreeNonVolatileMemory, true
+}
+
+// setError marks an entry as failed with a classified error.
+// An entry that was installed keeps that status, the error then concerns a later step.
+func (r *BatchEntryResult) setError(err error) {
+	ce := classifyError("download", err)
+	if r.Status != "installed" {
+		r.Status = "failed"
+	}
+	r.Error, r.Code, r.Category = ce.Error(), ce.code, string(ce.category)
+}
+
+// readBatchManifest reads manifest entries from a JSON array or a CSV file with a header row
+func readBatchManifest(path string) ([]BatchEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidManifest, err)
+	}
+
+	var entries []BatchEntry
+	if strings.EqualFold(filepath.Ext(path), ".json") || bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&entries); err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidManifest, err)
+		}
+	} else if entries, err = readBatchCSV(data); err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: no entries", errInvalidManifest)
+	}
+	return entries, nil
+}
+
+// readBatchCSV reads CSV manifest rows; the header names the columns as in the JSON manifest
+func readBatchCSV(data []byte) ([]BatchEntry, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidManifest, err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "activation_code", "confirmation_code", "imei", "nickname", "enable":
+			columns[name] = i
+		default:
+			return nil, fmt.Errorf("%w: unknown column %q", errInvalidManifest, name)
+		}
+	}
+	if _, ok := columns["activation_code"]; !ok {
+		return nil, fmt.Errorf("%w: activation_code column required", errInvalidManifest)
+	}
+
+	var entries []BatchEntry
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidManifest, err)
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		entry := BatchEntry{
+			ActivationCode:   field("activation_code"),
+			ConfirmationCode: field("confirmation_code"),
+			IMEI:             field("imei"),
+			Nickname:         field("nickname"),
+		}
+		if value := field("enable"); value != "" {
+			if entry.Enable, err = strconv.ParseBool(value); err != nil {
+				return nil, fmt.Errorf("%w: line %d: enable must be true or false, not %q", errInvalidManifest, line, value)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,242 @@
+//go:build openwrt
+
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// blob attribute header layout (libubox blob.h)
+const (
+	blobAttrExtended = 0x80000000
+	blobAttrIDMask   = 0x7f000000
+	blobAttrIDShift  = 24
+	blobAttrLenMask  = 0x00ffffff
+	blobAttrHdrLen   = 4
+)
+
+// blobmsg data types (libubox blobmsg.h)
+const (
+	blobmsgTypeUnspec = 0
+	blobmsgTypeArray  = 1
+	blobmsgTypeTable  = 2
+	blobmsgTypeString = 3
+	blobmsgTypeInt64  = 4
+	blobmsgTypeInt32  = 5
+	blobmsgTypeInt16  = 6
+	blobmsgTypeBool   = 7 // same as INT8
+	blobmsgTypeDouble = 8
+)
+
+// blobAttr is a single decoded blob attribute
+type blobAttr struct {
+	id       int
+	extended bool
+	data     []byte
+}
+
+// blobPad rounds a length up to the 4-byte blob alignment
+func blobPad(n int) int {
+	return (n + 3) &^ 3
+}
+
+// appendBlobAttr appends a padded blob attribute with the given payload
+func appendBlobAttr(buf *bytes.Buffer, id int, extended bool, payload []byte) {
+	hdr := uint32(id)<<blobAttrIDShift&blobAttrIDMask | uint32(blobAttrHdrLen+len(payload))&blobAttrLenMask
+	if extended {
+		hdr |= blobAttrExtended
+	}
+	binary.Write(buf, binary.BigEndian, hdr)
+	buf.Write(payload)
+	buf.Write(make([]byte, blobPad(len(payload))-len(payload)))
+}
+
+// parseBlobAttrs splits a buffer into consecutive padded blob attributes
+func parseBlobAttrs(data []byte) ([]blobAttr, error) {
+	var attrs []blobAttr
+	for len(data) > 0 {
+		if len(data) < blobAttrHdrLen {
+			return nil, fmt.Errorf("truncated blob attribute header")
+		}
+		hdr := binary.BigEndian.Uint32(data)
+		length := int(hdr & blobAttrLenMask)
+		if length < blobAttrHdrLen || length > len(data) {
+			return nil, fmt.Errorf("invalid blob attribute length %d", length)
+		}
+		attrs = append(attrs, blobAttr{
+			id:       int(hdr&blobAttrIDMask) >> blobAttrIDShift,
+			extended: hdr&blobAttrExtended != 0,
+			data:     data[blobAttrHdrLen:length],
+		})
+		if padded := blobPad(length); padded < len(data) {
+			data = data[padded:]
+		} else {
+			break
+		}
+	}
+	return attrs, nil
+}
+
+// blobString returns a NUL-terminated string payload
+func blobString(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+// blobUint32 returns a big-endian 32-bit payload
+func blobUint32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+// appendBlobmsg appends a named blobmsg attribute holding v.
+// v is expected to be a JSON-decoded value (map, slice, string, float64, bool).
+// nil values are skipped since blobmsg has no null type.
+func appendBlobmsg(buf *bytes.Buffer, name string, v interface{}) {
+	var typ int
+	var data []byte
+
+	switch val := v.(type) {
+	case nil:
+		return
+	case map[string]interface{}:
+		typ, data = blobmsgTypeTable, encodeBlobmsgTable(val)
+	case []interface{}:
+		var inner bytes.Buffer
+		for _, item := range val {
+			appendBlobmsg(&inner, "", item)
+		}
+		typ, data = blobmsgTypeArray, inner.Bytes()
+	case string:
+		typ, data = blobmsgTypeString, blobString(val)
+	case bool:
+		typ, data = blobmsgTypeBool, []byte{0}
+		if val {
+			data[0] = 1
+		}
+	case float64:
+		switch {
+		case val == math.Trunc(val) && val >= math.MinInt32 && val <= math.MaxInt32:
+			typ, data = blobmsgTypeInt32, blobUint32(uint32(int32(val)))
+		case val == math.Trunc(val) && val >= math.MinInt64 && val < math.MaxInt64:
+			typ, data = blobmsgTypeInt64, make([]byte, 8)
+			binary.BigEndian.PutUint64(data, uint64(int64(val)))
+		default:
+			typ, data = blobmsgTypeDouble, make([]byte, 8)
+			binary.BigEndian.PutUint64(data, math.Float64bits(val))
+		}
+	default:
+		typ, data = blobmsgTypeString, blobString(fmt.Sprint(val))
+	}
+
+	// blobmsg header: 16-bit name length, NUL-terminated name, padded
+	hdr := make([]byte, blobPad(2+len(name)+1))
+	binary.BigEndian.PutUint16(hdr, uint16(len(name)))
+	copy(hdr[2:], name)
+
+	appendBlobAttr(buf, typ, true, append(hdr, data...))
+}
+
+// encodeBlobmsgTable encodes a map as the payload of a blobmsg table.
+// Keys are sorted so the output is deterministic.
+func encodeBlobmsgTable(table map[string]interface{}) []byte {
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, key := range keys {
+		appendBlobmsg(&buf, key, table[key])
+	}
+	return buf.Bytes()
+}
+
+// decodeBlobmsgTable decodes the payload of a blobmsg table into a map
+func decodeBlobmsgTable(data []byte) (map[string]interface{}, error) {
+	attrs, err := parseBlobAttrs(data)
+	if err != nil {
+		return nil, err
+	}
+
+	table := make(map[string]interface{}, len(attrs))
+	for _, attr := range attrs {
+		name, value, err := decodeBlobmsg(attr)
+		if err != nil {
+			return nil, err
+		}
+		table[name] = value
+	}
+	return table, nil
+}
+
+// decodeBlobmsg decodes a single blobmsg attribute into its name and value
+func decodeBlobmsg(attr blobAttr) (string, interface{}, error) {
+	if !attr.extended || len(attr.data) < 2 {
+		return "", nil, fmt.Errorf("not a blobmsg attribute")
+	}
+	nameLen := int(binary.BigEndian.Uint16(attr.data))
+	hdrLen := blobPad(2 + nameLen + 1)
+	if hdrLen > len(attr.data) {
+		return "", nil, fmt.Errorf("truncated blobmsg header")
+	}
+	name := string(attr.data[2 : 2+nameLen])
+	data := attr.data[hdrLen:]
+
+	switch attr.id {
+	case blobmsgTypeTable:
+		table, err := decodeBlobmsgTable(data)
+		return name, table, err
+	case blobmsgTypeArray:
+		attrs, err := parseBlobAttrs(data)
+		if err != nil {
+			return name, nil, err
+		}
+		array := make([]interface{}, 0, len(attrs))
+		for _, item := range attrs {
+			_, value, err := decodeBlobmsg(item)
+			if err != nil {
+				return name, nil, err
+			}
+			array = append(array, value)
+		}
+		return name, array, nil
+	case blobmsgTypeString:
+		return name, string(bytes.TrimRight(data, "\x00")), nil
+	case blobmsgTypeBool:
+		if len(data) < 1 {
+			return name, nil, fmt.Errorf("truncated bool %q", name)
+		}
+		return name, data[0] != 0, nil
+	case blobmsgTypeInt16:
+		if len(data) < 2 {
+			return name, nil, fmt.Errorf("truncated int16 %q", name)
+		}
+		return name, float64(int16(binary.BigEndian.Uint16(data))), nil
+	case blobmsgTypeInt32:
+		if len(data) < 4 {
+			return name, nil, fmt.Errorf("truncated int32 %q", name)
+		}
+		return name, float64(int32(binary.BigEndian.Uint32(data))), nil
+	case blobmsgTypeInt64:
+		if len(data) < 8 {
+			return name, nil, fmt.Errorf("truncated int64 %q", name)
+		}
+		return name, float64(int64(binary.BigEndian.Uint64(data))), nil
+	case blobmsgTypeDouble:
+		if len(data) < 8 {
+			return name, nil, fmt.Errorf("truncated double %q", name)
+		}
+		return name, math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	default:
+		return name, nil, nil
+	}
+}
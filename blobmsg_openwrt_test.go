@@ -0,0 +1,162 @@
+//go:build openwrt
+
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// roundTrip encodes a table and decodes it again
+func roundTrip(t *testing.T, table map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	encoded := encodeBlobmsgTable(table)
+	if len(encoded)%4 != 0 {
+		t.Fatalf("encoded table is %d bytes, not 4-byte aligned", len(encoded))
+	}
+	decoded, err := decodeBlobmsgTable(encoded)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return decoded
+}
+
+func TestBlobmsgRoundTrip(t *testing.T) {
+	table := map[string]interface{}{
+		"success": true,
+		"failed":  false,
+		"data": map[string]interface{}{
+			"eid": "89049032000001000000012345678901",
+			"profiles": []interface{}{
+				map[string]interface{}{"iccid": "8944476500001224158", "state": "enabled", "class": float64(2)},
+				map[string]interface{}{"iccid": "8988247000100000017", "state": "disabled", "nickname": ""},
+			},
+			"free_memory": float64(math.MaxInt32),
+			"negative":    float64(math.MinInt32),
+			"large":       float64(math.MaxInt32 + 1),
+			"small":       float64(math.MinInt32 - 1),
+			"fraction":    1.5,
+			"empty":       map[string]interface{}{},
+			"nested":      []interface{}{[]interface{}{"a", float64(1)}, []interface{}{}, true},
+		},
+	}
+	if decoded := roundTrip(t, table); !reflect.DeepEqual(decoded, table) {
+		t.Errorf("round trip changed the table\n got %#v\nwant %#v", decoded, table)
+	}
+}
+
+func TestBlobmsgSkipsNil(t *testing.T) {
+	decoded := roundTrip(t, map[string]interface{}{"kept": "x", "dropped": nil})
+	if _, ok := decoded["dropped"]; ok || decoded["kept"] != "x" {
+		t.Errorf("got %#v, want only kept", decoded)
+	}
+}
+
+func TestBlobmsgIntegerTypes(t *testing.T) {
+	tests := []struct {
+		value float64
+		typ   int
+	}{
+		{0, blobmsgTypeInt32},
+		{math.MaxInt32, blobmsgTypeInt32},
+		{math.MinInt32, blobmsgTypeInt32},
+		{math.MaxInt32 + 1, blobmsgTypeInt64},
+		{math.MinInt32 - 1, blobmsgTypeInt64},
+		{1 << 53, blobmsgTypeInt64},
+		{0.25, blobmsgTypeDouble},
+		{math.MaxInt64, blobmsgTypeDouble},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		appendBlobmsg(&buf, "n", tt.value)
+		attrs, err := parseBlobAttrs(buf.Bytes())
+		if err != nil || len(attrs) != 1 {
+			t.Fatalf("%v: parse: %v", tt.value, err)
+		}
+		if attrs[0].id != tt.typ {
+			t.Errorf("%v encoded as type %d, want %d", tt.value, attrs[0].id, tt.typ)
+		}
+		if _, value, err := decodeBlobmsg(attrs[0]); err != nil || value != tt.value {
+			t.Errorf("%v decoded as %v (%v)", tt.value, value, err)
+		}
+	}
+}
+
+// The expected encodings follow blobmsg_add_field in libubox: the attribute length
+// excludes the trailing padding, the name header and the payload are padded to 4 bytes.
+func TestBlobmsgPadding(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		// header fits exactly: 2 + len("a") + NUL = 4
+		{"a", "b", "8300000a" + "0001" + "6100" + "6200" + "0000"},
+		// empty name still carries its NUL
+		{"", "", "83000009" + "0000" + "0000" + "00" + "000000"},
+		// a 2-byte name needs one byte of header padding
+		{"ab", "", "8300000d" + "0002" + "616200" + "000000" + "00" + "000000"},
+		// a bool needs three bytes of trailing padding
+		{"abc", true, "8700000d" + "0003" + "616263" + "000000" + "01" + "000000"},
+		// a payload that fills its 4 bytes gets no trailing padding
+		{"abcd", "xyz", "83000010" + "0004" + "61626364" + "0000" + "78797a00"},
+		{"n", float64(-1), "8500000c" + "0001" + "6e00" + "ffffffff"},
+		{"t", true, "87000009" + "0001" + "7400" + "01" + "000000"},
+		{"a", []interface{}{}, "81000008" + "0001" + "6100"},
+	}
+	for i, tt := range tests {
+		var buf bytes.Buffer
+		appendBlobmsg(&buf, tt.name, tt.value)
+		if got := hex.EncodeToString(buf.Bytes()); got != tt.want {
+			t.Errorf("case %d (%q): got %s, want %s", i, tt.name, got, tt.want)
+			continue
+		}
+
+		attrs, err := parseBlobAttrs(buf.Bytes())
+		if err != nil || len(attrs) != 1 {
+			t.Fatalf("case %d: parse: %v", i, err)
+		}
+		name, value, err := decodeBlobmsg(attrs[0])
+		if err != nil || name != tt.name || !reflect.DeepEqual(value, tt.value) {
+			t.Errorf("case %d: decoded %q=%#v (%v)", i, name, value, err)
+		}
+	}
+}
+
+func TestBlobmsgUnpaddedLastAttribute(t *testing.T) {
+	// ubusd may leave out the padding of the last attribute in a message
+	var buf bytes.Buffer
+	appendBlobmsg(&buf, "a", "b")
+	appendBlobmsg(&buf, "c", "d")
+	data := buf.Bytes()[:buf.Len()-2]
+
+	table, err := decodeBlobmsgTable(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(table, map[string]interface{}{"a": "b", "c": "d"}) {
+		t.Errorf("got %#v", table)
+	}
+}
+
+func TestBlobmsgRejectsMalformed(t *testing.T) {
+	tests := map[string][]byte{
+		"truncated header":     {0x85, 0x00},
+		"length below header":  {0x85, 0x00, 0x00, 0x02},
+		"length beyond buffer": {0x85, 0x00, 0x00, 0x40, 0x00, 0x00},
+		"not extended":         {0x05, 0x00, 0x00, 0x08, 0x00, 0x00, 0x00, 0x00},
+		"name beyond payload":  {0x83, 0x00, 0x00, 0x08, 0x00, 0x10, 0x61, 0x00},
+		"truncated int32":      {0x85, 0x00, 0x00, 0x0b, 0x00, 0x01, 0x6e, 0x00, 0x00, 0x00, 0x07},
+	}
+	for name, data := range tests {
+		if _, err := decodeBlobmsgTable(data); err == nil {
+			t.Errorf("%s: decoded without error", name)
+		}
+	}
+}
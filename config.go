@@ -16,10 +16,11 @@ import (
 // readConfigFile reads configuration from a key=value format config file
 func readConfigFile(configPath string) (*UCIConfig, error) {
 	config := &UCIConfig{
-		Driver:  "auto",
-		Device:  "",
-		Slot:    1,
-		Timeout: 30,
+		Driver:      "auto",
+		Device:      "",
+		Slot:        1,
+		Timeout:     30,
+		LockTimeout: 10,
 	}
 
 	file, err := os.Open(configPath)
@@ -67,6 +68,12 @@ func readConfigFile(configPath string) (*UCIConfig, error) {
 			if timeout, err := strconv.Atoi(value); err == nil && timeout > 0 {
 				config.Timeout = timeout
 			}
+		case "lock_timeout":
+			if lockTimeout, err := strconv.Atoi(value); err == nil && lockTimeout >= 0 {
+				config.LockTimeout = lockTimeout
+			}
+		case "outbox":
+			config.Outbox = value
 		}
 	}
 
@@ -110,3 +117,13 @@ func findConfigFile() string {
 
 	return ""
 }
+
+// defaultOutboxPath returns where notification-retry keeps its outbox:
+// $HOME/.config/hermes-euicc/outbox.json, or %APPDATA%\hermes-euicc\outbox.json on Windows
+func defaultOutboxPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "hermes-euicc-outbox.json"
+	}
+	return filepath.Join(dir, "hermes-euicc", "outbox.json")
+}
@@ -11,3 +11,10 @@ func readConfigFileCustom(configPath string) (*UCIConfig, error) {
 	// Return empty config, this will be ignored
 	return &UCIConfig{}, nil
 }
+
+// defaultOutboxPath keeps the notification outbox on flash, so notifications that failed
+// while offline are still sent after the reboot that often follows an outage.
+// The outbox option can move it to /var, which is RAM, to spare the flash.
+func defaultOutboxPath() string {
+	return "/etc/hermes-euicc/outbox.json"
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/KilimcininKorOglu/euicc-go/apdu"
+	"github.com/KilimcininKorOglu/euicc-go/lpa"
+)
+
+// DeviceInfo describes one transport a driver could open
+type DeviceInfo struct {
+	Driver       string `json:"driver"`
+	Path         string `json:"path,omitempty"`
+	Slot         int    `json:"slot,omitempty"`
+	KernelDriver string `json:"kernel_driver,omitempty"`
+	VendorID     string `json:"vendor_id,omitempty"`
+	ProductID    string `json:"product_id,omitempty"`
+	ISDR         bool   `json:"isdr"`
+	EID          string `json:"eid,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// deviceTarget is a discovered device together with a way to open it
+type deviceTarget struct {
+	info  DeviceInfo
+	group string // targets in one group reach the same eUICC (e.g. interfaces of one USB modem)
+	open  func() (apdu.SmartCardChannel, error)
+}
+
+// discoverDevices returns every modem node and PC/SC reader, in probe order
+func discoverDevices() []deviceTarget {
+	// Without sysfs enumeration, only report default paths that exist
+	candidates := enumerateModems()
+	if len(candidates) == 0 {
+		for _, c := range defaultModemCandidates() {
+			if strings.HasPrefix(c.Path, "/") {
+				if _, err := os.Stat(c.Path); err != nil {
+					continue
+				}
+			}
+			candidates = append(candidates, c)
+		}
+	}
+
+	var targets []deviceTarget
+	for _, c := range candidates {
+		t := deviceTarget{
+			info: DeviceInfo{
+				Driver:       c.Driver,
+				Path:         c.Path,
+				KernelDriver: c.KernelDriver,
+				VendorID:     c.VendorID,
+				ProductID:    c.ProductID,
+			},
+			group: c.USBDevice,
+			open: func() (apdu.SmartCardChannel, error) {
+				return createLockedDriver(c.Driver, c.Path, *slotNumber)
+			},
+		}
+		if t.group == "" {
+			t.group = c.Path
+		}
+		if c.Driver == "qmi" || c.Driver == "mbim" {
+			t.info.Slot = *slotNumber
+		}
+		targets = append(targets, t)
+	}
+
+	if ccidSupported {
+		readers, err := listCCIDReaders()
+		if err != nil {
+			targets = append(targets, deviceTarget{
+				info:  DeviceInfo{Driver: "ccid", Error: err.Error()},
+				group: "ccid",
+			})
+		}
+		for _, reader := range readers {
+			targets = append(targets, deviceTarget{
+				info:  DeviceInfo{Driver: "ccid", Path: reader},
+				group: "ccid:" + reader,
+				open: func() (apdu.SmartCardChannel, error) {
+					return createLockedDriver("ccid", reader, 0)
+				},
+			})
+		}
+	}
+
+	return targets
+}
+
+// handleDevices lists every modem node and PC/SC reader, probing each for an ISD-R and its EID
+func handleDevices(args []string) (interface{}, error) {
+	devicesFlags := flag.NewFlagSet("devices", flag.ContinueOnError)
+	noProbe := devicesFlags.Bool("no-probe", false, "List devices without opening them")
+	if err := devicesFlags.Parse(args); err != nil {
+		return nil, markError(errInvalidFlag, err)
+	}
+
+	devices := []DeviceInfo{}
+	for _, t := range discoverDevices() {
+		d := t.info
+		if !*noProbe && t.open != nil {
+			probeDevice(&d, t.open)
+		}
+		devices = append(devices, d)
+	}
+
+	return devices, nil
+}
+
+// openDeviceClient opens a device and selects its ISD-R
+func openDeviceClient(open func() (apdu.SmartCardChannel, error)) (*lpa.Client, error) {
+	channel, err := open()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := lpa.New(&lpa.Options{
+		Channel: channel,
+		Timeout: time.Duration(*timeout) * time.Second,
+	})
+	if err != nil {
+		// Release the device (and its lock) so the next target can be tried
+		channel.Disconnect()
+		return nil, err
+	}
+	return client, nil
+}
+
+// probeDevice opens a device, selects the ISD-R and reads the EID
+func probeDevice(d *DeviceInfo, open func() (apdu.SmartCardChannel, error)) {
+	client, err := openDeviceClient(open)
+	if err != nil {
+		d.Error = err.Error()
+		return
+	}
+	defer client.Close()
+	d.ISDR = true
+
+	eid, err := client.EID()
+	if err != nil {
+		d.Error = err.Error()
+		return
+	}
+	d.EID = hex.EncodeToString(eid)
+}
@@ -8,27 +8,15 @@ package main
 import (
 	"fmt"
 
-	"github.com/KilimcininKorOglu/euicc-go/apdu"
 	"github.com/KilimcininKorOglu/euicc-go/driver/ccid"
 )
 
-// initCCIDDriver initializes CCID driver using pcscd (Linux)
-func initCCIDDriver() (apdu.SmartCardChannel, error) {
+// newCCIDContext connects to pcscd (Linux)
+func newCCIDContext() (*ccid.CCID, error) {
 	ch, err := ccid.New()
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize CCID: %w (is pcscd running?)", err)
+		return nil, fmt.Errorf("%w: %w (is pcscd running?)", errPCSCUnavailable, err)
 	}
-
-	readers, err := ch.ListReaders()
-	if err != nil {
-		return nil, fmt.Errorf("failed to list readers: %w", err)
-	}
-
-	if len(readers) == 0 {
-		return nil, fmt.Errorf("no CCID readers found (please connect a USB smart card reader)")
-	}
-
-	ch.SetReader(readers[0])
 	return ch, nil
 }
 
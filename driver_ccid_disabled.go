@@ -13,8 +13,18 @@ import (
 
 // initCCIDDriver returns error on unsupported platforms (MIPS, 32-bit, etc.)
 // CCID (PC/SC) requires purego which doesn't support these architectures
-func initCCIDDriver() (apdu.SmartCardChannel, error) {
-	return nil, fmt.Errorf("CCID driver not supported on this platform (use QMI, MBIM, or AT driver)")
+func initCCIDDriver(selector string) (apdu.SmartCardChannel, error) {
+	return nil, fmt.Errorf("CCID %w (use QMI, MBIM, or AT driver)", errDriverUnsupported)
+}
+
+// resolveCCIDReader returns error on unsupported platforms
+func resolveCCIDReader(selector string) (string, error) {
+	return "", fmt.Errorf("CCID %w (use QMI, MBIM, or AT driver)", errDriverUnsupported)
+}
+
+// listCCIDReaders returns error on unsupported platforms
+func listCCIDReaders() ([]string, error) {
+	return nil, fmt.Errorf("CCID %w (use QMI, MBIM, or AT driver)", errDriverUnsupported)
 }
 
 const ccidSupported = false
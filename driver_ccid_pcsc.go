@@ -0,0 +1,118 @@
+//go:build !linux || amd64 || arm64
+
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/KilimcininKorOglu/euicc-go/apdu"
+	"github.com/KilimcininKorOglu/euicc-go/driver/ccid"
+)
+
+// initCCIDDriver initializes the CCID driver on the PC/SC reader matching selector
+// (exact name, index or name substring), or the first reader if selector is empty.
+// The readers are listed with the PC/SC context the channel then uses.
+func initCCIDDriver(selector string) (apdu.SmartCardChannel, error) {
+	ch, err := newCCIDContext()
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := findCCIDReader(ch, selector)
+	if err != nil {
+		ch.Disconnect()
+		return nil, err
+	}
+
+	ch.SetReader(reader)
+	return ch, nil
+}
+
+// resolveCCIDReader returns the name of the PC/SC reader matching selector
+func resolveCCIDReader(selector string) (string, error) {
+	ch, err := newCCIDContext()
+	if err != nil {
+		return "", err
+	}
+	defer ch.Disconnect()
+
+	return findCCIDReader(ch, selector)
+}
+
+// findCCIDReader lists the readers of a PC/SC context and picks the one matching selector
+func findCCIDReader(ch *ccid.CCID, selector string) (string, error) {
+	readers, err := ch.ListReaders()
+	if err != nil {
+		return "", fmt.Errorf("failed to list readers: %w", err)
+	}
+
+	if len(readers) == 0 {
+		return "", fmt.Errorf("%w (please connect a USB smart card reader)", errNoReader)
+	}
+
+	return selectReader(readers, selector)
+}
+
+// selectReader picks a reader by exact name, then by index, then by case-insensitive substring
+func selectReader(readers []string, selector string) (string, error) {
+	if selector == "" {
+		return readers[0], nil
+	}
+
+	for _, reader := range readers {
+		if reader == selector {
+			return reader, nil
+		}
+	}
+
+	if index, err := strconv.Atoi(selector); err == nil {
+		if index < 0 || index >= len(readers) {
+			return "", fmt.Errorf("%w index %d (available: %s)", errReaderNotFound, index, formatReaders(readers))
+		}
+		return readers[index], nil
+	}
+
+	var matches []string
+	for _, reader := range readers {
+		if strings.Contains(strings.ToLower(reader), strings.ToLower(selector)) {
+			matches = append(matches, reader)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%w %q (available: %s)", errReaderNotFound, selector, formatReaders(readers))
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("%q %w, use the full name or index (available: %s)", selector, errReaderAmbiguous, formatReaders(readers))
+	}
+}
+
+// formatReaders lists readers with their index, e.g. [0] "Reader A", [1] "Reader B"
+func formatReaders(readers []string) string {
+	list := make([]string, len(readers))
+	for i, reader := range readers {
+		list[i] = fmt.Sprintf("[%d] %q", i, reader)
+	}
+	return strings.Join(list, ", ")
+}
+
+// listCCIDReaders returns the names of the connected PC/SC readers
+func listCCIDReaders() ([]string, error) {
+	ch, err := newCCIDContext()
+	if err != nil {
+		return nil, err
+	}
+	defer ch.Disconnect()
+
+	readers, err := ch.ListReaders()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list readers: %w", err)
+	}
+	return readers, nil
+}
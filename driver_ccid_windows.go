@@ -8,29 +8,16 @@ package main
 import (
 	"fmt"
 
-	"github.com/KilimcininKorOglu/euicc-go/apdu"
 	"github.com/KilimcininKorOglu/euicc-go/driver/ccid"
 )
 
-// initCCIDDriver initializes CCID driver using winscard.dll (Windows)
+// newCCIDContext connects to winscard.dll (Windows)
 // Windows has built-in smart card support via winscard.dll
-func initCCIDDriver() (apdu.SmartCardChannel, error) {
+func newCCIDContext() (*ccid.CCID, error) {
 	ch, err := ccid.New()
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize CCID: %w (Smart Card service may not be running)", err)
+		return nil, fmt.Errorf("%w: %w (Smart Card service may not be running)", errPCSCUnavailable, err)
 	}
-
-	readers, err := ch.ListReaders()
-	if err != nil {
-		return nil, fmt.Errorf("failed to list readers: %w", err)
-	}
-
-	if len(readers) == 0 {
-		return nil, fmt.Errorf("no CCID readers found (please connect a USB smart card reader)")
-	}
-
-	// Use first available reader
-	ch.SetReader(readers[0])
 	return ch, nil
 }
 
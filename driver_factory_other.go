@@ -13,12 +13,12 @@ import (
 
 // newQMIDriver returns an error on non-Linux platforms (QMI is Linux-only)
 func newQMIDriver(device string, slot uint8) (apdu.SmartCardChannel, error) {
-	return nil, fmt.Errorf("QMI driver not supported on this platform (Linux only)")
+	return nil, fmt.Errorf("QMI %w (Linux only)", errDriverUnsupported)
 }
 
 // newMBIMDriver returns an error on non-Linux platforms (MBIM is Linux-only)
 func newMBIMDriver(device string, slot uint8) (apdu.SmartCardChannel, error) {
-	return nil, fmt.Errorf("MBIM driver not supported on this platform (Linux only)")
+	return nil, fmt.Errorf("MBIM %w (Linux only)", errDriverUnsupported)
 }
 
 // newATDriver is implemented in platform-specific files (driver_at_*.go)
@@ -0,0 +1,237 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/KilimcininKorOglu/euicc-go/apdu"
+)
+
+// traceEntry is one channel operation in an APDU trace file (one JSON object per line)
+type traceEntry struct {
+	Op       string `json:"op"` // connect, disconnect, open, close, transmit
+	AID      string `json:"aid,omitempty"`
+	Channel  int    `json:"channel,omitempty"`
+	Command  string `json:"command,omitempty"`
+	Response string `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// recordingChannel writes every operation on the wrapped channel to a trace file.
+// Matching IDs and confirmation codes are masked as in -trace-apdu, so the file can be shared.
+type recordingChannel struct {
+	channel apdu.SmartCardChannel
+	file    *os.File
+	encoder *json.Encoder
+	pending []tracedAPDU
+}
+
+// newRecordingChannel wraps a channel so its exchanges are recorded to path
+func newRecordingChannel(channel apdu.SmartCardChannel, path string) (apdu.SmartCardChannel, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidTraceFile, err)
+	}
+	fmt.Fprintf(os.Stderr, "Recording APDUs to %s: matching IDs and confirmation codes are masked, the EID and ICCIDs are not\n", path)
+	return &recordingChannel{channel: channel, file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (r *recordingChannel) record(entry traceEntry, err error) {
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	r.encoder.Encode(entry)
+}
+
+func (r *recordingChannel) Connect() error {
+	err := r.channel.Connect()
+	r.record(traceEntry{Op: "connect"}, err)
+	return err
+}
+
+func (r *recordingChannel) Disconnect() error {
+	r.flush()
+	err := r.channel.Disconnect()
+	r.record(traceEntry{Op: "disconnect"}, err)
+	r.file.Close()
+	return err
+}
+
+func (r *recordingChannel) OpenLogicalChannel(aid []byte) (byte, error) {
+	channel, err := r.channel.OpenLogicalChannel(aid)
+	r.record(traceEntry{Op: "open", AID: hex.EncodeToString(aid), Channel: int(channel)}, err)
+	return channel, err
+}
+
+func (r *recordingChannel) CloseLogicalChannel(channel byte) error {
+	r.flush()
+	err := r.channel.CloseLogicalChannel(channel)
+	r.record(traceEntry{Op: "close", Channel: int(channel)}, err)
+	return err
+}
+
+func (r *recordingChannel) Transmit(command []byte) ([]byte, error) {
+	response, err := r.channel.Transmit(command)
+	r.pending = append(r.pending, tracedAPDU{command: command, response: response, err: err})
+	if exchangeComplete(command, response, err) {
+		r.flush()
+	}
+	return response, err
+}
+
+// flush records the pending APDUs of an ES10 command with their sensitive values masked
+func (r *recordingChannel) flush() {
+	commands, responses := maskExchange(r.pending)
+	for i, p := range r.pending {
+		r.record(traceEntry{Op: "transmit", Command: commands[i], Response: responses[i]}, p.err)
+	}
+	r.pending = nil
+}
+
+// replayDriver answers channel operations from a recorded trace.
+// Operations must arrive in the recorded order with identical commands.
+type replayDriver struct {
+	path    string
+	entries []traceEntry
+	next    int
+}
+
+// newReplayDriver loads a trace file recorded with -record
+func newReplayDriver(path string) (apdu.SmartCardChannel, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w for replay driver (the trace file)", errDeviceRequired)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidTraceFile, err)
+	}
+	defer file.Close()
+
+	r := &replayDriver{path: path}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var entry traceEntry
+		if err := json.Unmarshal([]byte(text), &entry); err != nil {
+			return nil, fmt.Errorf("%w %s line %d: %w", errInvalidTraceFile, path, line, err)
+		}
+		r.entries = append(r.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidTraceFile, err)
+	}
+	return r, nil
+}
+
+// expect returns the next recorded entry, which must be of the given operation
+func (r *replayDriver) expect(op string) (*traceEntry, error) {
+	if r.next >= len(r.entries) {
+		return nil, fmt.Errorf("%w: trace exhausted after %d entries, unexpected %s", errReplayMismatch, len(r.entries), op)
+	}
+	entry := &r.entries[r.next]
+	if entry.Op != op {
+		return nil, fmt.Errorf("%w: entry %d is %s, got %s", errReplayMismatch, r.next+1, entry.Op, op)
+	}
+	r.next++
+	return entry, nil
+}
+
+// result converts a recorded error message back into an error
+func (e *traceEntry) result() error {
+	if e.Error != "" {
+		return errors.New(e.Error)
+	}
+	return nil
+}
+
+func (r *replayDriver) Connect() error {
+	entry, err := r.expect("connect")
+	if err != nil {
+		return err
+	}
+	return entry.result()
+}
+
+// Disconnect is lenient since traces of failed commands end without a disconnect
+func (r *replayDriver) Disconnect() error {
+	if r.next >= len(r.entries) || r.entries[r.next].Op != "disconnect" {
+		return nil
+	}
+	r.next++
+	return r.entries[r.next-1].result()
+}
+
+func (r *replayDriver) OpenLogicalChannel(aid []byte) (byte, error) {
+	entry, err := r.expect("open")
+	if err != nil {
+		return 0, err
+	}
+	if !strings.EqualFold(entry.AID, hex.EncodeToString(aid)) {
+		return 0, fmt.Errorf("%w: entry %d opened AID %s, got %X", errReplayMismatch, r.next, entry.AID, aid)
+	}
+	return byte(entry.Channel), entry.result()
+}
+
+func (r *replayDriver) CloseLogicalChannel(channel byte) error {
+	entry, err := r.expect("close")
+	if err != nil {
+		return err
+	}
+	return entry.result()
+}
+
+func (r *replayDriver) Transmit(command []byte) ([]byte, error) {
+	entry, err := r.expect("transmit")
+	if err != nil {
+		return nil, err
+	}
+	match, err := matchRecordedHex(entry.Command, command)
+	if err != nil {
+		return nil, fmt.Errorf("%w: entry %d has invalid command: %w", errReplayMismatch, r.next, err)
+	}
+	if !match {
+		return nil, fmt.Errorf("%w: entry %d command mismatch: recorded %s, got %X", errReplayMismatch, r.next, entry.Command, command)
+	}
+	if strings.Contains(entry.Response, "**") {
+		return nil, fmt.Errorf("%w: entry %d response was masked when recorded", errReplayMismatch, r.next)
+	}
+	response, err := hex.DecodeString(entry.Response)
+	if err != nil {
+		return nil, fmt.Errorf("%w: entry %d has invalid response: %w", errReplayMismatch, r.next, err)
+	}
+	return response, entry.result()
+}
+
+// matchRecordedHex compares a recorded hex string with data; bytes masked as ** match any value
+func matchRecordedHex(recorded string, data []byte) (bool, error) {
+	if len(recorded) != 2*len(data) {
+		return false, nil
+	}
+	for i, b := range data {
+		pair := recorded[2*i : 2*i+2]
+		if pair == "**" {
+			continue
+		}
+		v, err := hex.DecodeString(pair)
+		if err != nil {
+			return false, err
+		}
+		if v[0] != b {
+			return false, nil
+		}
+	}
+	return true, nil
+}
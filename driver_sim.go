@@ -0,0 +1,631 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/KilimcininKorOglu/euicc-go/apdu"
+)
+
+// simDefaultStatePath is used when -driver sim is given without -device
+const simDefaultStatePath = "hermes-euicc-sim.json"
+
+// isdrAID is the AID of the ISD-R (SGP.22 2.2.3)
+var isdrAID = []byte{0xA0, 0x00, 0x00, 0x05, 0x59, 0x10, 0x10, 0xFF, 0xFF, 0xFF, 0xFF, 0x89, 0x00, 0x00, 0x01, 0x00}
+
+// simCIPKID is the subject key identifier of the GSMA test CI
+var simCIPKID = []byte{0xF5, 0x41, 0x72, 0xBD, 0xF9, 0x8A, 0x95, 0xD6, 0x5C, 0xBE, 0xB8, 0x8A, 0x38, 0xA1, 0xC1, 0x1D, 0x80, 0x0A, 0x85, 0xC3}
+
+// errSimUnsupported is returned for ES10 commands the simulator does not implement
+var errSimUnsupported = errors.New("command not supported by simulated eUICC")
+
+// Profile classes as encoded in ProfileInfo (SGP.22 5.7.15)
+var simProfileClasses = map[string]byte{
+	"test":         0,
+	"provisioning": 1,
+	"operational":  2,
+}
+
+// NotificationEvent bit strings (SGP.22 2.4.4): unused bits followed by the event bit
+var simNotificationEvents = map[string][]byte{
+	"install": {0x07, 0x80},
+	"enable":  {0x06, 0x40},
+	"disable": {0x05, 0x20},
+	"delete":  {0x04, 0x10},
+}
+
+// simState is the persistent state of the simulated eUICC
+type simState struct {
+	EID                   string            `json:"eid"`
+	DefaultSMDPAddress    string            `json:"default_smdp_address"`
+	RootSMDSAddress       string            `json:"root_smds_address"`
+	FreeNonVolatileMemory uint32            `json:"free_non_volatile_memory"`
+	FreeVolatileMemory    uint32            `json:"free_volatile_memory"`
+	Profiles              []simProfile      `json:"profiles"`
+	Notifications         []simNotification `json:"notifications"`
+	NextSequenceNumber    int               `json:"next_sequence_number"`
+}
+
+type simProfile struct {
+	ICCID               string `json:"iccid"`
+	ISDPAID             string `json:"isdp_aid"`
+	Enabled             bool   `json:"enabled"`
+	ProfileName         string `json:"profile_name,omitempty"`
+	ProfileNickname     string `json:"profile_nickname,omitempty"`
+	ServiceProviderName string `json:"service_provider_name,omitempty"`
+	ProfileClass        string `json:"profile_class"`
+	NotificationAddress string `json:"notification_address,omitempty"`
+}
+
+type simNotification struct {
+	SequenceNumber int    `json:"sequence_number"`
+	Operation      string `json:"operation"`
+	Address        string `json:"address"`
+	ICCID          string `json:"iccid"`
+}
+
+// defaultSimState returns the state a new simulated eUICC starts with
+func defaultSimState() *simState {
+	return &simState{
+		EID:                   "89049032123451234512345678901235",
+		DefaultSMDPAddress:    "smdp.example.com",
+		RootSMDSAddress:       "lpa.ds.gsma.com",
+		FreeNonVolatileMemory: 262144,
+		FreeVolatileMemory:    16384,
+		Profiles: []simProfile{
+			{
+				ICCID:               "8944476500001224158",
+				ISDPAID:             "A0000005591010FFFFFFFF8900001000",
+				Enabled:             true,
+				ProfileName:         "Simulated Home",
+				ServiceProviderName: "Sim Operator",
+				ProfileClass:        "operational",
+				NotificationAddress: "smdp.example.com",
+			},
+			{
+				ICCID:               "8988247000100000017",
+				ISDPAID:             "A0000005591010FFFFFFFF8900001100",
+				ProfileName:         "Simulated Travel",
+				ServiceProviderName: "Sim Roaming",
+				ProfileClass:        "operational",
+				NotificationAddress: "smdp.example.com",
+			},
+		},
+		Notifications:      []simNotification{},
+		NextSequenceNumber: 1,
+	}
+}
+
+// simDriver emulates an ISD-R in memory and persists its state to a JSON file.
+// Profile download is not supported since it requires SM-DP+ keys.
+type simDriver struct {
+	path   string
+	state  *simState
+	buffer []byte
+}
+
+// newSimDriver creates a simulated eUICC backed by the given state file.
+// The file is created with a default state if it does not exist.
+func newSimDriver(path string) (apdu.SmartCardChannel, error) {
+	if path == "" {
+		path = simDefaultStatePath
+	}
+
+	s := &simDriver{path: path}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		s.state = defaultSimState()
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, fmt.Errorf("failed to read simulator state: %w", err)
+	default:
+		s.state = &simState{}
+		if err := json.Unmarshal(data, s.state); err != nil {
+			return nil, fmt.Errorf("invalid simulator state %s: %w", path, err)
+		}
+		if err := s.state.validate(); err != nil {
+			return nil, fmt.Errorf("invalid simulator state %s: %w", path, err)
+		}
+	}
+	return s, nil
+}
+
+// validate rejects values that cannot be encoded for the card, such as a misspelled profile class
+func (st *simState) validate() error {
+	for _, p := range st.Profiles {
+		if _, ok := simProfileClasses[p.ProfileClass]; !ok {
+			return fmt.Errorf("profile %s: unknown profile_class %q (use test, provisioning or operational)", p.ICCID, p.ProfileClass)
+		}
+	}
+	for _, n := range st.Notifications {
+		if _, ok := simNotificationEvents[n.Operation]; !ok {
+			return fmt.Errorf("notification %d: unknown operation %q (use install, enable, disable or delete)", n.SequenceNumber, n.Operation)
+		}
+	}
+	return nil
+}
+
+func (s *simDriver) Connect() error    { return nil }
+func (s *simDriver) Disconnect() error { return nil }
+
+func (s *simDriver) OpenLogicalChannel(aid []byte) (byte, error) {
+	if !bytes.Equal(aid, isdrAID) {
+		return 0, fmt.Errorf("simulated eUICC: unknown AID %X", aid)
+	}
+	return 1, nil
+}
+
+func (s *simDriver) CloseLogicalChannel(channel byte) error { return nil }
+
+// Transmit handles STORE DATA commands carrying ES10 requests
+func (s *simDriver) Transmit(command []byte) ([]byte, error) {
+	if len(command) < 4 {
+		return nil, fmt.Errorf("simulated eUICC: APDU too short")
+	}
+	if command[1] != 0xE2 {
+		return []byte{0x6D, 0x00}, nil // INS not supported
+	}
+
+	var data []byte
+	switch {
+	case len(command) > 7 && command[4] == 0x00:
+		length := int(command[5])<<8 | int(command[6])
+		if 7+length > len(command) {
+			return []byte{0x67, 0x00}, nil
+		}
+		data = command[7 : 7+length]
+	case len(command) > 5:
+		length := int(command[4])
+		if 5+length > len(command) {
+			return []byte{0x67, 0x00}, nil
+		}
+		data = command[5 : 5+length]
+	}
+
+	// P1 bit 8 marks the last block of a segmented command
+	s.buffer = append(s.buffer, data...)
+	if command[2]&0x80 == 0 {
+		return []byte{0x90, 0x00}, nil
+	}
+	request := s.buffer
+	s.buffer = nil
+
+	response, err := s.handle(request)
+	if errors.Is(err, errSimUnsupported) {
+		return []byte{0x6A, 0x88}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(response.bytes(), 0x90, 0x00), nil
+}
+
+// handle dispatches an ES10 request to its implementation
+func (s *simDriver) handle(data []byte) (*tlv, error) {
+	request, _, err := parseTLV(data)
+	if err != nil {
+		return nil, fmt.Errorf("simulated eUICC: %w", err)
+	}
+
+	switch request.tag {
+	case 0xBF3E: // GetEuiccDataRequest
+		eid, _ := hex.DecodeString(s.state.EID)
+		return newConstructedTLV(0xBF3E, newTLV(0x5A, eid)), nil
+	case 0xBF20: // GetEuiccInfo1Request
+		return s.euiccInfo1(), nil
+	case 0xBF22: // GetEuiccInfo2Request
+		return s.euiccInfo2(), nil
+	case 0xBF2D: // ProfileInfoListRequest
+		return s.profileInfoList(request), nil
+	case 0xBF31: // EnableProfileRequest
+		return s.mutate(0xBF31, s.enableProfile(request.find(0xA0)))
+	case 0xBF32: // DisableProfileRequest
+		return s.mutate(0xBF32, s.disableProfile(request.find(0xA0)))
+	case 0xBF33: // DeleteProfileRequest
+		return s.mutate(0xBF33, s.deleteProfile(request))
+	case 0xBF29: // SetNicknameRequest
+		return s.mutate(0xBF29, s.setNickname(request))
+	case 0xBF34: // EuiccMemoryResetRequest
+		return s.mutate(0xBF34, s.memoryReset(request))
+	case 0xBF28: // ListNotificationRequest
+		return s.listNotification(request), nil
+	case 0xBF2B: // RetrieveNotificationsListRequest
+		return s.retrieveNotificationsList(request), nil
+	case 0xBF30: // NotificationSentRequest
+		return s.mutate(0xBF30, s.removeNotification(request))
+	case 0xBF2E: // GetEuiccChallengeRequest
+		challenge := make([]byte, 16)
+		if _, err := rand.Read(challenge); err != nil {
+			return nil, err
+		}
+		return newConstructedTLV(0xBF2E, newTLV(0x80, challenge)), nil
+	case 0xBF3C: // EuiccConfiguredAddressesRequest
+		return newConstructedTLV(0xBF3C,
+			newTLV(0x80, []byte(s.state.DefaultSMDPAddress)),
+			newTLV(0x81, []byte(s.state.RootSMDSAddress)),
+		), nil
+	case 0xBF3F: // SetDefaultDpAddressRequest
+		if address := request.find(0x80); address != nil {
+			s.state.DefaultSMDPAddress = string(address.value)
+		}
+		return s.mutate(0xBF3F, 0)
+	case 0xBF43: // GetRATRequest
+		return newConstructedTLV(0xBF43), nil
+	default:
+		return nil, errSimUnsupported
+	}
+}
+
+// mutate persists the state and wraps a result code in the response tag
+func (s *simDriver) mutate(tag uint32, result byte) (*tlv, error) {
+	if result == 0 {
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+	}
+	return newConstructedTLV(tag, newTLV(0x80, []byte{result})), nil
+}
+
+func (s *simDriver) euiccInfo1() *tlv {
+	return newConstructedTLV(0xBF20,
+		newTLV(0x82, []byte{0x02, 0x02, 0x00}),
+		newConstructedTLV(0xA9, newTLV(0x04, simCIPKID)),
+		newConstructedTLV(0xAA, newTLV(0x04, simCIPKID)),
+	)
+}
+
+func (s *simDriver) euiccInfo2() *tlv {
+	// extCardResource as defined in ETSI TS 102 226
+	resource := newTLV(0x81, []byte{byte(len(s.state.Profiles))}).bytes()
+	resource = append(resource, newTLV(0x82, encodeInteger(int(s.state.FreeNonVolatileMemory))).bytes()...)
+	resource = append(resource, newTLV(0x83, encodeInteger(int(s.state.FreeVolatileMemory))).bytes()...)
+
+	return newConstructedTLV(0xBF22,
+		newTLV(0x81, []byte{0x02, 0x01, 0x00}),       // profileVersion
+		newTLV(0x82, []byte{0x02, 0x02, 0x00}),       // svn
+		newTLV(0x83, []byte{0x01, 0x00, 0x00}),       // euiccFirmwareVer
+		newTLV(0x84, resource),                       // extCardResource
+		newTLV(0x85, []byte{0x06, 0x7F, 0x36, 0xC0}), // uiccCapability
+		newTLV(0x86, []byte{0x09, 0x02, 0x00}),       // ts102241Version
+		newTLV(0x87, []byte{0x02, 0x03, 0x00}),       // globalplatformVersion
+		newTLV(0x88, []byte{0x04, 0xF0}),             // rspCapability
+		newConstructedTLV(0xA9, newTLV(0x04, simCIPKID)),
+		newConstructedTLV(0xAA, newTLV(0x04, simCIPKID)),
+		newTLV(0x8B, []byte{0x01}),              // euiccCategory: basicEuicc
+		newTLV(0x04, []byte{0x00, 0x00, 0x00}),  // ppVersion
+		newTLV(0x0C, []byte("SIM-HERMES-0001")), // sasAcreditationNumber
+		newConstructedTLV(0xAC,
+			newTLV(0x80, []byte("Hermes Simulator")),
+			newTLV(0x81, []byte("https://example.com/euicc")),
+		),
+	)
+}
+
+func (s *simDriver) profileInfoList(request *tlv) *tlv {
+	var criteria *tlv
+	if search := request.find(0xA0); search != nil && len(search.children) > 0 {
+		criteria = search.children[0]
+	}
+
+	list := newConstructedTLV(0xA0)
+	for _, p := range s.state.Profiles {
+		iccid := encodeICCID(p.ICCID)
+		aid, _ := hex.DecodeString(p.ISDPAID)
+		class := simProfileClasses[p.ProfileClass]
+
+		if criteria != nil {
+			switch criteria.tag {
+			case 0x5A:
+				if !bytes.Equal(criteria.value, iccid) {
+					continue
+				}
+			case 0x4F:
+				if !bytes.Equal(criteria.value, aid) {
+					continue
+				}
+			case 0x95:
+				if len(criteria.value) != 1 || criteria.value[0] != class {
+					continue
+				}
+			}
+		}
+
+		state := byte(0)
+		if p.Enabled {
+			state = 1
+		}
+		info := newConstructedTLV(0xE3,
+			newTLV(0x5A, iccid),
+			newTLV(0x4F, aid),
+			newTLV(0x9F70, []byte{state}),
+		)
+		// Optional strings are omitted when empty, as real cards do
+		optional := []*tlv{
+			newTLV(0x90, []byte(p.ProfileNickname)),
+			newTLV(0x91, []byte(p.ServiceProviderName)),
+			newTLV(0x92, []byte(p.ProfileName)),
+		}
+		for _, field := range optional {
+			if len(field.value) > 0 {
+				info.children = append(info.children, field)
+			}
+		}
+		info.children = append(info.children, newTLV(0x95, []byte{class}))
+		list.children = append(list.children, info)
+	}
+	return newConstructedTLV(0xBF2D, list)
+}
+
+// findProfile returns the index of the profile matching an ISD-P AID or ICCID data object
+func (s *simDriver) findProfile(id *tlv) int {
+	if id == nil {
+		return -1
+	}
+	for i, p := range s.state.Profiles {
+		switch id.tag {
+		case 0x5A:
+			if bytes.Equal(id.value, encodeICCID(p.ICCID)) {
+				return i
+			}
+		case 0x4F:
+			if aid, _ := hex.DecodeString(p.ISDPAID); bytes.Equal(id.value, aid) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// profileIdentifier returns the ICCID or ISD-P AID child of a request
+func profileIdentifier(t *tlv) *tlv {
+	if t == nil {
+		return nil
+	}
+	if id := t.find(0x5A); id != nil {
+		return id
+	}
+	return t.find(0x4F)
+}
+
+func (s *simDriver) enableProfile(id *tlv) byte {
+	i := s.findProfile(profileIdentifier(id))
+	if i < 0 {
+		return 1 // iccidOrAidNotFound
+	}
+	if s.state.Profiles[i].Enabled {
+		return 2 // profileNotInDisabledState
+	}
+	for j := range s.state.Profiles {
+		if s.state.Profiles[j].Enabled {
+			s.state.Profiles[j].Enabled = false
+			s.addNotification("disable", s.state.Profiles[j])
+		}
+	}
+	s.state.Profiles[i].Enabled = true
+	s.addNotification("enable", s.state.Profiles[i])
+	return 0
+}
+
+func (s *simDriver) disableProfile(id *tlv) byte {
+	i := s.findProfile(profileIdentifier(id))
+	if i < 0 {
+		return 1 // iccidOrAidNotFound
+	}
+	if !s.state.Profiles[i].Enabled {
+		return 2 // profileNotInEnabledState
+	}
+	s.state.Profiles[i].Enabled = false
+	s.addNotification("disable", s.state.Profiles[i])
+	return 0
+}
+
+func (s *simDriver) deleteProfile(request *tlv) byte {
+	i := s.findProfile(profileIdentifier(request))
+	if i < 0 {
+		return 1 // iccidOrAidNotFound
+	}
+	if s.state.Profiles[i].Enabled {
+		return 2 // profileNotInDisabledState
+	}
+	s.addNotification("delete", s.state.Profiles[i])
+	s.state.Profiles = append(s.state.Profiles[:i], s.state.Profiles[i+1:]...)
+	return 0
+}
+
+func (s *simDriver) setNickname(request *tlv) byte {
+	i := s.findProfile(request.find(0x5A))
+	if i < 0 {
+		return 1 // iccidNotFound
+	}
+	if nickname := request.find(0x90); nickname != nil {
+		s.state.Profiles[i].ProfileNickname = string(nickname.value)
+	} else {
+		s.state.Profiles[i].ProfileNickname = ""
+	}
+	return 0
+}
+
+func (s *simDriver) memoryReset(request *tlv) byte {
+	// resetOptions: deleteOperationalProfiles(0), deleteFieldLoadedTestProfiles(1), resetDefaultSmdpAddress(2)
+	var options byte
+	if opt := request.find(0x82); opt != nil && len(opt.value) > 1 {
+		options = opt.value[1]
+	}
+
+	changed := false
+	profiles := s.state.Profiles[:0]
+	for _, p := range s.state.Profiles {
+		if (options&0x80 != 0 && p.ProfileClass == "operational") || (options&0x40 != 0 && p.ProfileClass == "test") {
+			changed = true
+			continue
+		}
+		profiles = append(profiles, p)
+	}
+	s.state.Profiles = profiles
+
+	if options&0x20 != 0 && s.state.DefaultSMDPAddress != "" {
+		s.state.DefaultSMDPAddress = ""
+		changed = true
+	}
+
+	if !changed {
+		return 1 // nothingToDelete
+	}
+	return 0
+}
+
+// addNotification queues a notification for a profile that has a notification address
+func (s *simDriver) addNotification(operation string, p simProfile) {
+	if p.NotificationAddress == "" {
+		return
+	}
+	s.state.Notifications = append(s.state.Notifications, simNotification{
+		SequenceNumber: s.state.NextSequenceNumber,
+		Operation:      operation,
+		Address:        p.NotificationAddress,
+		ICCID:          p.ICCID,
+	})
+	s.state.NextSequenceNumber++
+}
+
+// metadata encodes the NotificationMetadata of a notification
+func (n simNotification) metadata() *tlv {
+	return newConstructedTLV(0xBF2F,
+		newTLV(0x80, encodeInteger(n.SequenceNumber)),
+		newTLV(0x81, simNotificationEvents[n.Operation]),
+		newTLV(0x0C, []byte(n.Address)),
+		newTLV(0x5A, encodeICCID(n.ICCID)),
+	)
+}
+
+// matches reports whether the notification event is set in a NotificationEvent filter
+func (n simNotification) matches(filter *tlv) bool {
+	if filter == nil {
+		return true
+	}
+	event := simNotificationEvents[n.Operation]
+	return len(filter.value) > 1 && len(event) > 1 && filter.value[1]&event[1] != 0
+}
+
+func (s *simDriver) listNotification(request *tlv) *tlv {
+	list := newConstructedTLV(0xA0)
+	for _, n := range s.state.Notifications {
+		if n.matches(request.find(0x81)) {
+			list.children = append(list.children, n.metadata())
+		}
+	}
+	return newConstructedTLV(0xBF28, list)
+}
+
+func (s *simDriver) retrieveNotificationsList(request *tlv) *tlv {
+	seq := -1
+	var filter *tlv
+	if criteria := request.find(0xA0); criteria != nil {
+		if number := criteria.find(0x80); number != nil {
+			seq = decodeInteger(number.value)
+		}
+		filter = criteria.find(0x81)
+	}
+
+	// Signatures and certificates are placeholders, the simulator holds no keys
+	signature := newTLV(0x5F37, make([]byte, 64))
+	list := newConstructedTLV(0xA0)
+	for _, n := range s.state.Notifications {
+		if (seq >= 0 && n.SequenceNumber != seq) || !n.matches(filter) {
+			continue
+		}
+		var pending *tlv
+		if n.Operation == "install" {
+			pending = newConstructedTLV(0xBF37,
+				newConstructedTLV(0xBF27, newTLV(0x80, make([]byte, 16)), n.metadata()),
+				signature,
+			)
+		} else {
+			pending = newConstructedTLV(0x30, n.metadata(), signature)
+		}
+		list.children = append(list.children, pending)
+	}
+	return newConstructedTLV(0xBF2B, list)
+}
+
+func (s *simDriver) removeNotification(request *tlv) byte {
+	number := request.find(0x80)
+	if number == nil {
+		return 127 // undefinedError
+	}
+	seq := decodeInteger(number.value)
+	for i, n := range s.state.Notifications {
+		if n.SequenceNumber == seq {
+			s.state.Notifications = append(s.state.Notifications[:i], s.state.Notifications[i+1:]...)
+			return 0
+		}
+	}
+	return 1 // nothingToDelete
+}
+
+// save writes the state file atomically
+func (s *simDriver) save() error {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write simulator state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write simulator state: %w", err)
+	}
+	return nil
+}
+
+// encodeICCID encodes ICCID digits as swapped-nibble BCD padded with F
+func encodeICCID(iccid string) []byte {
+	digits := strings.ToUpper(iccid)
+	if len(digits)%2 != 0 {
+		digits += "F"
+	}
+	out := make([]byte, 0, len(digits)/2)
+	for i := 0; i < len(digits); i += 2 {
+		b, _ := hex.DecodeString(string([]byte{digits[i+1], digits[i]}))
+		out = append(out, b...)
+	}
+	return out
+}
+
+// encodeInteger encodes a non-negative ASN.1 INTEGER value
+func encodeInteger(n int) []byte {
+	var out []byte
+	for {
+		out = append([]byte{byte(n)}, out...)
+		n >>= 8
+		if n == 0 {
+			break
+		}
+	}
+	if out[0]&0x80 != 0 {
+		out = append([]byte{0x00}, out...)
+	}
+	return out
+}
+
+// decodeInteger decodes a non-negative ASN.1 INTEGER value
+func decodeInteger(b []byte) int {
+	n := 0
+	for _, v := range b {
+		n = n<<8 | int(v)
+	}
+	return n
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// modemCandidate is a device node that auto-detection can probe with a driver
+type modemCandidate struct {
+	Driver       string `json:"driver"`                  // qmi, mbim or at
+	Path         string `json:"path"`                    // e.g. /dev/cdc-wdm0
+	KernelDriver string `json:"kernel_driver,omitempty"` // e.g. qmi_wwan, cdc_mbim, option
+	VendorID     string `json:"vendor_id,omitempty"`
+	ProductID    string `json:"product_id,omitempty"`
+	USBDevice    string `json:"usb_device,omitempty"` // sysfs USB device name, e.g. 1-1.2
+	Interface    int    `json:"interface"`            // USB interface number, -1 if unknown
+}
+
+// modemCandidates returns the devices to probe during auto-detection, in probe order.
+// If device is set, only candidates for that node are returned.
+func modemCandidates(device string) []modemCandidate {
+	candidates := enumerateModems()
+	if len(candidates) == 0 {
+		candidates = defaultModemCandidates()
+	}
+	if device == "" {
+		return candidates
+	}
+
+	var matching []modemCandidate
+	for _, c := range candidates {
+		if c.Path == device {
+			matching = append(matching, c)
+		}
+	}
+	if len(matching) > 0 {
+		return matching
+	}
+
+	// Node not found by enumeration: guess the protocol from its name
+	if strings.Contains(device, "cdc-wdm") {
+		return []modemCandidate{
+			{Driver: "qmi", Path: device, Interface: -1},
+			{Driver: "mbim", Path: device, Interface: -1},
+		}
+	}
+	return []modemCandidate{{Driver: "at", Path: device, Interface: -1}}
+}
+
+// defaultModemCandidates returns the well-known device paths used when enumeration finds nothing
+func defaultModemCandidates() []modemCandidate {
+	var candidates []modemCandidate
+	if qmiSupported {
+		candidates = append(candidates, modemCandidate{Driver: "qmi", Path: "/dev/cdc-wdm0", Interface: -1})
+	}
+	if mbimSupported {
+		candidates = append(candidates, modemCandidate{Driver: "mbim", Path: "/dev/cdc-wdm0", Interface: -1})
+	}
+	if atSupported {
+		for _, dev := range defaultATDevices() {
+			candidates = append(candidates, modemCandidate{Driver: "at", Path: dev, Interface: -1})
+		}
+	}
+	return candidates
+}
+
+// sortModemCandidates orders candidates by driver (QMI, MBIM, AT), then by the
+// interface that most likely carries AT commands, then by device node number
+func sortModemCandidates(candidates []modemCandidate) {
+	driverRank := map[string]int{"qmi": 0, "mbim": 1, "at": 2}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if driverRank[a.Driver] != driverRank[b.Driver] {
+			return driverRank[a.Driver] < driverRank[b.Driver]
+		}
+		if a.Driver == "at" && atInterfaceRank(a.Interface) != atInterfaceRank(b.Interface) {
+			return atInterfaceRank(a.Interface) < atInterfaceRank(b.Interface)
+		}
+		return naturalLess(a.Path, b.Path)
+	})
+}
+
+// atInterfaceRank prefers the interfaces Quectel, Sierra and SIMCom modems use for AT commands
+// (2, 3, 1, 0), matching the order of the former fixed ttyUSB list
+func atInterfaceRank(iface int) int {
+	switch iface {
+	case 2:
+		return 0
+	case 3:
+		return 1
+	case 1:
+		return 2
+	case 0:
+		return 3
+	case -1:
+		return 1 << 16
+	default:
+		return 4 + iface
+	}
+}
+
+// naturalLess compares device paths so that cdc-wdm2 sorts before cdc-wdm10
+func naturalLess(a, b string) bool {
+	ap, an := splitTrailingNumber(a)
+	bp, bn := splitTrailingNumber(b)
+	if ap != bp {
+		return ap < bp
+	}
+	return an < bn
+}
+
+func splitTrailingNumber(s string) (string, int) {
+	i := len(s)
+	for i > 0 && s[i-1] >= '0' && s[i-1] <= '9' {
+		i--
+	}
+	n, err := strconv.Atoi(s[i:])
+	if err != nil {
+		return s, -1
+	}
+	return s[:i], n
+}
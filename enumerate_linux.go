@@ -0,0 +1,119 @@
+//go:build linux
+
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sysfsRoot is where sysfs is mounted; point it at a fake tree to test enumeration
+var sysfsRoot = "/sys"
+
+// enumerateModems discovers cdc-wdm and USB serial nodes from sysfs, in probe order
+func enumerateModems() []modemCandidate {
+	var candidates []modemCandidate
+
+	// cdc-wdm control nodes of QMI and MBIM modems
+	usbmisc := filepath.Join(sysfsRoot, "class", "usbmisc")
+	for _, name := range sysfsList(usbmisc) {
+		if !strings.HasPrefix(name, "cdc-wdm") {
+			continue
+		}
+		c := sysfsCandidate(filepath.Join(usbmisc, name), name)
+		switch c.KernelDriver {
+		case "qmi_wwan":
+			c.Driver = "qmi"
+			candidates = append(candidates, c)
+		case "cdc_mbim":
+			c.Driver = "mbim"
+			candidates = append(candidates, c)
+		default:
+			// Unknown driver: try both protocols
+			qmi, mbim := c, c
+			qmi.Driver, mbim.Driver = "qmi", "mbim"
+			candidates = append(candidates, qmi, mbim)
+		}
+	}
+
+	// USB serial ports (option, qcserial, cdc_acm, ...) carrying AT commands
+	tty := filepath.Join(sysfsRoot, "class", "tty")
+	for _, name := range sysfsList(tty) {
+		if !strings.HasPrefix(name, "ttyUSB") && !strings.HasPrefix(name, "ttyACM") {
+			continue
+		}
+		c := sysfsCandidate(filepath.Join(tty, name), name)
+		c.Driver = "at"
+		candidates = append(candidates, c)
+	}
+
+	// Drop drivers not built for this platform
+	supported := candidates[:0]
+	for _, c := range candidates {
+		if (c.Driver == "qmi" && qmiSupported) || (c.Driver == "mbim" && mbimSupported) || (c.Driver == "at" && atSupported) {
+			supported = append(supported, c)
+		}
+	}
+
+	sortModemCandidates(supported)
+	return supported
+}
+
+// sysfsCandidate resolves the USB interface behind a class device and reads its kernel driver and IDs
+func sysfsCandidate(classDir, name string) modemCandidate {
+	c := modemCandidate{Path: "/dev/" + name, Interface: -1}
+
+	device, err := filepath.EvalSymlinks(filepath.Join(classDir, "device"))
+	if err != nil {
+		return c
+	}
+
+	// cdc-wdm and ttyACM link to the interface (1-1.2:1.4), USB serial ports to a port below it
+	iface := filepath.Base(device)
+	if !strings.Contains(iface, ":") {
+		iface = filepath.Base(filepath.Dir(device))
+	}
+	sep := strings.Index(iface, ":")
+	if sep < 0 {
+		return c
+	}
+
+	usbDevices := filepath.Join(sysfsRoot, "bus", "usb", "devices")
+	if target, err := os.Readlink(filepath.Join(usbDevices, iface, "driver")); err == nil {
+		c.KernelDriver = filepath.Base(target)
+	}
+	if n, err := strconv.ParseUint(sysfsRead(filepath.Join(usbDevices, iface, "bInterfaceNumber")), 16, 8); err == nil {
+		c.Interface = int(n)
+	}
+	c.USBDevice = iface[:sep]
+	c.VendorID = sysfsRead(filepath.Join(usbDevices, c.USBDevice, "idVendor"))
+	c.ProductID = sysfsRead(filepath.Join(usbDevices, c.USBDevice, "idProduct"))
+	return c
+}
+
+// sysfsList returns the entry names of a sysfs directory, or nil if it does not exist
+func sysfsList(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+// sysfsRead returns the trimmed content of a sysfs attribute, or "" if unreadable
+func sysfsRead(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
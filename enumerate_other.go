@@ -0,0 +1,11 @@
+//go:build !linux
+
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+// enumerateModems returns nil on non-Linux platforms; the default device paths are probed instead
+func enumerateModems() []modemCandidate {
+	return nil
+}
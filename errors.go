@@ -0,0 +1,463 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/KilimcininKorOglu/euicc-go/lpa"
+)
+
+// errorCategory groups errors for scripts; each category has its own exit code
+type errorCategory string
+
+const (
+	categoryInternal   errorCategory = "internal"
+	categoryValidation errorCategory = "validation"
+	categoryDriver     errorCategory = "driver"
+	categoryTransport  errorCategory = "transport"
+	categoryCard       errorCategory = "card"
+	categorySMDP       errorCategory = "smdp"
+	categoryNetwork    errorCategory = "network"
+)
+
+// exitCodes maps error categories to process exit codes
+var exitCodes = map[errorCategory]int{
+	categoryInternal:   1,
+	categoryValidation: 2,
+	categoryDriver:     3,
+	categoryTransport:  4,
+	categoryCard:       5,
+	categorySMDP:       6,
+	categoryNetwork:    7,
+}
+
+// httpStatuses maps error categories to HTTP API status codes
+var httpStatuses = map[errorCategory]int{
+	categoryInternal:   http.StatusInternalServerError,
+	categoryValidation: http.StatusBadRequest,
+	categoryDriver:     http.StatusServiceUnavailable,
+	categoryTransport:  http.StatusServiceUnavailable,
+	categoryCard:       http.StatusUnprocessableEntity,
+	categorySMDP:       http.StatusBadGateway,
+	categoryNetwork:    http.StatusBadGateway,
+}
+
+// ErrorDetails carries the underlying SGP.22 or ISO 7816 codes of an error, where known
+type ErrorDetails struct {
+	StatusWord  string `json:"status_word,omitempty"`
+	ResultCode  *int   `json:"result_code,omitempty"`
+	SubjectCode string `json:"subject_code,omitempty"`
+	ReasonCode  string `json:"reason_code,omitempty"`
+}
+
+// commandError is an error with a stable machine-readable code
+type commandError struct {
+	category errorCategory
+	code     string
+	details  *ErrorDetails
+	data     interface{}
+	err      error
+}
+
+func (e *commandError) Error() string { return e.err.Error() }
+func (e *commandError) Unwrap() error { return e.err }
+
+func (e *commandError) exitCode() int   { return exitCodes[e.category] }
+func (e *commandError) httpStatus() int { return httpStatuses[e.category] }
+
+// response builds the JSON error envelope
+func (e *commandError) response() Response {
+	return Response{
+		Success:  false,
+		Data:     e.data,
+		Error:    e.err.Error(),
+		Code:     e.code,
+		Category: string(e.category),
+		Details:  e.details,
+	}
+}
+
+// runCommand executes a registered command and classifies its error
+func runCommand(client *lpa.Client, command string, args []string) (interface{}, error) {
+	data, err := commands[command](client, args)
+	if err != nil {
+		return nil, classifyError(command, err)
+	}
+	return data, nil
+}
+
+// errorResponse builds the JSON error envelope for err
+func errorResponse(err error) Response {
+	return classifyError("", err).response()
+}
+
+// resultCode is a named SGP.22 ES10 result or error code
+type resultCode struct {
+	name  string
+	value int
+}
+
+// resultCodes lists the ES10 result codes of each command (SGP.22 section 5.7)
+var resultCodes = map[string][]resultCode{
+	"enable": {
+		{"iccidOrAidNotFound", 1}, {"profileNotInDisabledState", 2}, {"disallowedByPolicy", 3},
+		{"wrongProfileReenabling", 4}, {"catBusy", 5}, {"undefinedError", 127},
+	},
+	"disable": {
+		{"iccidOrAidNotFound", 1}, {"profileNotInEnabledState", 2}, {"disallowedByPolicy", 3},
+		{"catBusy", 5}, {"undefinedError", 127},
+	},
+	"delete": {
+		{"iccidOrAidNotFound", 1}, {"profileNotInDisabledState", 2}, {"disallowedByPolicy", 3},
+		{"undefinedError", 127},
+	},
+	"nickname": {
+		{"iccidNotFound", 1}, {"undefinedError", 127},
+	},
+	"memory-reset": {
+		{"nothingToDelete", 1}, {"catBusy", 5}, {"undefinedError", 127},
+	},
+	"set-default-dp": {
+		{"undefinedError", 127},
+	},
+	"notification-remove": {
+		{"nothingToDelete", 1}, {"undefinedError", 127},
+	},
+	// AuthenticateServer, PrepareDownload and ProfileInstallationResult
+	"download": {
+		{"invalidCertificate", 1}, {"invalidSignature", 2}, {"unsupportedCurve", 3},
+		{"noSessionContext", 4}, {"invalidOid", 5}, {"euiccChallengeMismatch", 6}, {"ciPKUnknown", 7},
+		{"incorrectInputValues", 1}, {"invalidTransactionId", 3}, {"unsupportedCrtValues", 4},
+		{"unsupportedRemoteOperationType", 5}, {"unsupportedProfileClass", 6},
+		{"scp03tStructureError", 7}, {"scp03tSecurityError", 8},
+		{"installFailedDueToIccidAlreadyExistsOnEuicc", 9},
+		{"installFailedDueToInsufficientMemoryForProfile", 10},
+		{"installFailedDueToInterruption", 11}, {"installFailedDueToPEProcessingError", 12},
+		{"installFailedDueToDataMismatch", 13}, {"testProfileInstallFailedDueToInvalidNaaKey", 14},
+		{"pprNotAllowed", 15}, {"installFailedDueToUnknownError", 127}, {"undefinedError", 127},
+	},
+}
+
+func init() {
+	resultCodes["discover-download"] = resultCodes["download"]
+	resultCodes["switch"] = resultCodes["enable"]
+}
+
+// smdpReasons names common SM-DP+ subject/reason code pairs (SGP.22 ES9+)
+var smdpReasons = map[string]string{
+	"8.1/6.1":    "euicc_signature_invalid",
+	"8.1.1/3.8":  "eid_refused",
+	"8.1.2/6.1":  "eum_certificate_invalid",
+	"8.1.2/6.3":  "eum_certificate_expired",
+	"8.1.3/6.1":  "euicc_certificate_invalid",
+	"8.1.3/6.3":  "euicc_certificate_expired",
+	"8.2/1.2":    "profile_not_released",
+	"8.2.5/4.3":  "no_eligible_profile",
+	"8.2.6/3.8":  "matching_id_refused",
+	"8.2.7/2.2":  "confirmation_code_required",
+	"8.2.7/3.8":  "confirmation_code_refused",
+	"8.2.7/6.4":  "confirmation_code_retries_exceeded",
+	"8.8.5/4.10": "download_order_expired",
+	"8.8.5/6.4":  "max_retries_exceeded",
+	"8.10.1/3.9": "unknown_transaction_id",
+	"8.11.1/3.9": "unknown_ci_public_key",
+}
+
+// statusWords names common ISO 7816-4 status words returned by the eUICC
+var statusWords = map[string]string{
+	"6581": "memory_failure",
+	"6700": "wrong_length",
+	"6982": "security_status_not_satisfied",
+	"6985": "conditions_not_satisfied",
+	"6A80": "incorrect_data",
+	"6A82": "application_not_found",
+	"6A86": "incorrect_p1_p2",
+	"6A88": "referenced_data_not_found",
+	"6D00": "instruction_not_supported",
+	"6E00": "class_not_supported",
+	"6F00": "unknown_card_error",
+}
+
+// Errors of this program that scripts can tell apart, wrapped with %w where they are returned
+var (
+	errNoDriver                = errors.New("no compatible driver found")
+	errDriverUnsupported       = errors.New("driver not supported on this platform")
+	errUnknownDriver           = errors.New("unknown driver type")
+	errDeviceRequired          = errors.New("device path required")
+	errNoReader                = errors.New("no CCID readers found")
+	errReaderAmbiguous         = errors.New("matches several CCID readers")
+	errReaderNotFound          = errors.New("no CCID reader matches")
+	errPCSCUnavailable         = errors.New("failed to initialize CCID")
+	errReplayMismatch          = errors.New("replay")
+	errInvalidTraceFile        = errors.New("invalid trace file")
+	errUnknownCommand          = errors.New("unknown command")
+	errUnknownEndpoint         = errors.New("unknown endpoint")
+	errMethodNotAllowed        = errors.New("method not allowed")
+	errInvalidRequest          = errors.New("invalid request body")
+	errUnsupportedPlatform     = errors.New("not supported on this platform")
+	errNotOverAPI              = errors.New("not available over the API")
+	errFleetUnsupported        = errors.New("cannot run with -all-devices")
+	errUsage                   = errors.New("usage")
+	errMissingArgument         = errors.New("missing argument")
+	errInvalidFlag             = errors.New("invalid use of flag")
+	errInvalidFlagValue        = errors.New("invalid value")
+	errInvalidICCID            = errors.New("invalid ICCID")
+	errInvalidSelector         = errors.New("invalid profile selector")
+	errActivationCodeRequired  = errors.New("activation code required")
+	errInvalidActivationCode   = errors.New("invalid activation code")
+	errInvalidQRImage          = errors.New("invalid QR image")
+	errInvalidManifest         = errors.New("invalid manifest")
+	errInvalidOutbox           = errors.New("invalid outbox")
+	errInvalidNotificationFile = errors.New("invalid notification file")
+	errInvalidIMEI             = errors.New("invalid IMEI")
+	errInvalidSequenceNumber   = errors.New("invalid sequence number")
+	errSequenceNumberRequired  = errors.New("sequence number(s) required")
+	errNotificationNotFound    = errors.New("notification not found")
+	errDriverInit              = errors.New("failed to initialize driver")
+	errCardOperation           = errors.New("eUICC operation failed")
+	errSMDPOperation           = errors.New("SM-DP+ operation failed")
+)
+
+// knownErrors classifies the errors of this program, checked in order
+var knownErrors = []struct {
+	err      error
+	category errorCategory
+	code     string
+}{
+	{errDeviceBusy, categoryDriver, "device_busy"},
+	{errNoDriver, categoryDriver, "no_driver_found"},
+	{errDriverUnsupported, categoryDriver, "driver_unsupported"},
+	{errUnknownDriver, categoryValidation, "unknown_driver"},
+	{errDeviceRequired, categoryValidation, "device_required"},
+	{errNoReader, categoryDriver, "no_reader"},
+	{errReaderAmbiguous, categoryValidation, "reader_ambiguous"},
+	{errReaderNotFound, categoryValidation, "reader_not_found"},
+	{errPCSCUnavailable, categoryDriver, "pcsc_unavailable"},
+	{errReplayMismatch, categoryTransport, "replay_mismatch"},
+	{errInvalidTraceFile, categoryValidation, "invalid_trace_file"},
+	{errUnknownCommand, categoryValidation, "unknown_command"},
+	{errUnknownEndpoint, categoryValidation, "unknown_endpoint"},
+	{errMethodNotAllowed, categoryValidation, "method_not_allowed"},
+	{errInvalidRequest, categoryValidation, "invalid_request"},
+	{errUnsupportedPlatform, categoryValidation, "unsupported_command"},
+	{errNotOverAPI, categoryValidation, "unsupported_command"},
+	{errFleetUnsupported, categoryValidation, "unsupported_command"},
+	{errUsage, categoryValidation, "missing_argument"},
+	{errMissingArgument, categoryValidation, "missing_argument"},
+	{errInvalidFlag, categoryValidation, "invalid_flag"},
+	{errInvalidFlagValue, categoryValidation, "invalid_flag"},
+	{errInvalidICCID, categoryValidation, "invalid_iccid"},
+	{errInvalidSelector, categoryValidation, "invalid_iccid"},
+	{errActivationCodeRequired, categoryValidation, "invalid_activation_code"},
+	{errInvalidActivationCode, categoryValidation, "invalid_activation_code"},
+	{errInvalidQRImage, categoryValidation, "invalid_qr_image"},
+	{errInvalidManifest, categoryValidation, "invalid_manifest"},
+	{errInvalidOutbox, categoryValidation, "invalid_outbox"},
+	{errInvalidNotificationFile, categoryValidation, "invalid_notification_file"},
+	{errInvalidIMEI, categoryValidation, "invalid_imei"},
+	{errInvalidSequenceNumber, categoryValidation, "invalid_sequence_number"},
+	{errSequenceNumberRequired, categoryValidation, "invalid_sequence_number"},
+	{errNotificationNotFound, categoryCard, "notification_not_found"},
+	{errNoDevice, categoryDriver, "no_device"},
+}
+
+// markedError tags an error from the flag package or the euicc-go library with one of the
+// errors above, keeping its message
+type markedError struct {
+	kind error
+	err  error
+}
+
+func (e *markedError) Error() string   { return e.err.Error() }
+func (e *markedError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// markError tags err with kind; it returns nil when err is nil
+func markError(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &markedError{kind: kind, err: err}
+}
+
+// cardError tags an error returned by an ES10 call to the eUICC
+func cardError(err error) error { return markError(errCardOperation, err) }
+
+// smdpError tags an error returned by a call that talks to an SM-DP+ or SM-DS
+func smdpError(err error) error { return markError(errSMDPOperation, err) }
+
+var (
+	smdpReasonPattern = regexp.MustCompile(`(?is)subject[ _-]?code\W{0,3}([0-9.]*[0-9]).*?reason[ _-]?code\W{0,3}([0-9.]*[0-9])`)
+	resultCodePattern = regexp.MustCompile(`(?i)(?:result|error)[ _-]?code\W{0,3}(\d+)`)
+	statusWordPattern = regexp.MustCompile(`(?i)\b(?:sw|status word|status)\W{0,3}([0-9a-f]{4})\b`)
+)
+
+// classifyError assigns a category and code to err.
+// command selects the SGP.22 result code table; it may be empty.
+func classifyError(command string, err error) *commandError {
+	var ce *commandError
+	if errors.As(err, &ce) {
+		return ce
+	}
+
+	ce = &commandError{category: categoryInternal, code: "unknown_error", err: err}
+
+	for _, k := range knownErrors {
+		if errors.Is(err, k.err) {
+			ce.category, ce.code = k.category, k.code
+			return ce
+		}
+	}
+	if classifySGP22(ce, command, err.Error()) || classifyNetwork(ce, err) || classifyTransport(ce, err) {
+		return ce
+	}
+	// Library errors without a code the patterns know still keep the category of their call
+	switch {
+	case errors.Is(err, errCardOperation):
+		ce.category, ce.code = categoryCard, "card_error"
+	case errors.Is(err, errSMDPOperation):
+		ce.category, ce.code = categorySMDP, "smdp_error"
+	case errors.Is(err, errDriverInit):
+		ce.category, ce.code = categoryDriver, "driver_init_failed"
+	}
+	return ce
+}
+
+// classifySGP22 parses SM-DP+ reason codes, ES10 result codes and card status words out of an error message
+func classifySGP22(ce *commandError, command, message string) bool {
+	if m := smdpReasonPattern.FindStringSubmatch(message); m != nil {
+		ce.category, ce.code = categorySMDP, "smdp_error"
+		if code, ok := smdpReasons[m[1]+"/"+m[2]]; ok {
+			ce.code = code
+		}
+		ce.details = &ErrorDetails{SubjectCode: m[1], ReasonCode: m[2]}
+		return true
+	}
+
+	// Result codes by name (profileNotInDisabledState, profile not in disabled state, ...)
+	normalized := normalizeCodeName(message)
+	for _, rc := range resultCodes[command] {
+		if strings.Contains(normalized, normalizeCodeName(rc.name)) {
+			value := rc.value
+			ce.category, ce.code = categoryCard, snakeCase(rc.name)
+			ce.details = &ErrorDetails{ResultCode: &value}
+			return true
+		}
+	}
+	// Result codes by number, named when the value is unambiguous for the command
+	if m := resultCodePattern.FindStringSubmatch(message); m != nil {
+		value, _ := strconv.Atoi(m[1])
+		ce.category, ce.code = categoryCard, "card_error"
+		var names []string
+		for _, rc := range resultCodes[command] {
+			if rc.value == value {
+				names = append(names, rc.name)
+			}
+		}
+		if len(names) == 1 {
+			ce.code = snakeCase(names[0])
+		}
+		ce.details = &ErrorDetails{ResultCode: &value}
+		return true
+	}
+
+	if m := statusWordPattern.FindStringSubmatch(message); m != nil && !strings.EqualFold(m[1], "9000") {
+		sw := strings.ToUpper(m[1])
+		ce.category, ce.code = categoryCard, "card_status_word"
+		if code, ok := statusWords[sw]; ok {
+			ce.code = code
+		}
+		ce.details = &ErrorDetails{StatusWord: sw}
+		return true
+	}
+	return false
+}
+
+// classifyNetwork recognizes errors talking to SM-DP+ and SM-DS servers
+func classifyNetwork(ce *commandError, err error) bool {
+	var dnsErr *net.DNSError
+	var unknownAuthority x509.UnknownAuthorityError
+	var certInvalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	var recordHeader tls.RecordHeaderError
+	var urlErr *url.Error
+	var opErr *net.OpError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &dnsErr):
+		ce.code = "dns_error"
+	case errors.As(err, &unknownAuthority), errors.As(err, &certInvalid), errors.As(err, &hostname), errors.As(err, &recordHeader):
+		ce.code = "tls_error"
+	case errors.As(err, &urlErr), errors.As(err, &opErr):
+		ce.code = "connection_failed"
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			ce.code = "timeout"
+		}
+	case errors.Is(err, context.DeadlineExceeded):
+		ce.code = "timeout"
+	default:
+		return false
+	}
+	ce.category = categoryNetwork
+	return true
+}
+
+// classifyTransport recognizes errors opening or talking to the device
+func classifyTransport(ce *commandError, err error) bool {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		ce.code = "device_not_found"
+	case errors.Is(err, os.ErrPermission):
+		ce.code = "permission_denied"
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		ce.code = "timeout"
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		ce.code = "unexpected_eof"
+	default:
+		return false
+	}
+	ce.category = categoryTransport
+	return true
+}
+
+// normalizeCodeName lowercases s and drops everything but letters and digits
+func normalizeCodeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+// snakeCase converts an SGP.22 name such as profileNotInDisabledState to profile_not_in_disabled_state
+func snakeCase(name string) string {
+	var sb strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// Start a word at a lower-to-upper change, or at the last capital of an acronym (PEProcessing)
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				sb.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
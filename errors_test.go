@@ -0,0 +1,40 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		err      error
+		category errorCategory
+		code     string
+	}{
+		{"flag", "download", markError(errInvalidFlag, errors.New("some new flag wording")), categoryValidation, "invalid_flag"},
+		{"ICCID", "download", markError(errInvalidICCID, errors.New("bad digits")), categoryValidation, "invalid_iccid"},
+		{"no device", "notification-send", fmt.Errorf("notification 3: %w", errNoDevice), categoryDriver, "no_device"},
+		{"card without code", "enable", cardError(errors.New("something unexpected")), categoryCard, "card_error"},
+		{"card result code", "enable", cardError(errors.New("result code 2")), categoryCard, "profile_not_in_disabled_state"},
+		{"SM-DP+ without code", "download", smdpError(errors.New("something unexpected")), categorySMDP, "smdp_error"},
+		{"SM-DP+ reason", "download", smdpError(errors.New("subject code 8.2.6, reason code 3.8")), categorySMDP, "matching_id_refused"},
+		{"untagged", "enable", errors.New("something unexpected"), categoryInternal, "unknown_error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ce := classifyError(tt.command, tt.err)
+			if ce.category != tt.category || ce.code != tt.code {
+				t.Errorf("got %s/%s, want %s/%s", ce.category, ce.code, tt.category, tt.code)
+			}
+			if ce.Error() != tt.err.Error() {
+				t.Errorf("message changed to %q", ce.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/KilimcininKorOglu/euicc-go/lpa"
+	sgp22 "github.com/KilimcininKorOglu/euicc-go/v2"
+)
+
+// downloadEvents receives one JSON line per download event when -events is set.
+// It stays nil for the serve and ubus daemons.
+var downloadEvents io.Writer
+
+// DownloadEvent is one line of the -events stream
+type DownloadEvent struct {
+	Event     string                   `json:"event"`
+	SMDP      string                   `json:"smdp,omitempty"`
+	Stage     string                   `json:"stage,omitempty"`
+	Step      int                      `json:"step,omitempty"`
+	Metadata  *ProfileMetadataResponse `json:"metadata,omitempty"`
+	Confirmed *bool                    `json:"confirmed,omitempty"`
+	Provided  *bool                    `json:"provided,omitempty"`
+	Error     string                   `json:"error,omitempty"`
+	Code      string                   `json:"code,omitempty"`
+	Category  string                   `json:"category,omitempty"`
+}
+
+// emitDownloadEvent writes an event to the -events stream, if there is one
+func emitDownloadEvent(event DownloadEvent) {
+	if downloadEvents == nil {
+		return
+	}
+	if err := json.NewEncoder(downloadEvents).Encode(event); err != nil {
+		log.Printf("Failed to write download event: %v\n", err)
+	}
+}
+
+// downloadEventOptions wraps the download callbacks so every stage is also reported as an event
+func downloadEventOptions(opts *lpa.DownloadOptions) *lpa.DownloadOptions {
+	onProgress, onConfirm, onConfirmationCode := opts.OnProgress, opts.OnConfirm, opts.OnEnterConfirmationCode
+	step := 0
+	return &lpa.DownloadOptions{
+		OnProgress: func(stage lpa.DownloadStage) {
+			step++
+			emitDownloadEvent(DownloadEvent{Event: "stage", Stage: fmt.Sprint(stage), Step: step})
+			onProgress(stage)
+		},
+		OnConfirm: func(metadata *sgp22.ProfileInfo) bool {
+			if metadata != nil {
+				emitDownloadEvent(DownloadEvent{Event: "metadata", Metadata: profileMetadata(metadata)})
+			}
+			confirmed := onConfirm(metadata)
+			emitDownloadEvent(DownloadEvent{Event: "confirmation", Confirmed: &confirmed})
+			return confirmed
+		},
+		OnEnterConfirmationCode: func() string {
+			code := onConfirmationCode()
+			provided := code != ""
+			emitDownloadEvent(DownloadEvent{Event: "confirmation-code", Provided: &provided})
+			return code
+		},
+	}
+}
+
+// emitDownloadResult reports the end of a download as a done or error event
+func emitDownloadResult(err error) {
+	if err == nil {
+		emitDownloadEvent(DownloadEvent{Event: "done"})
+		return
+	}
+	ce := classifyError("download", err)
+	emitDownloadEvent(DownloadEvent{Event: "error", Error: ce.Error(), Code: ce.code, Category: string(ce.category)})
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// singleDeviceFlags are global flags that select or wrap one device and cannot apply to a fleet
+var singleDeviceFlags = []string{"driver", "device", "record", "trace-apdu", "trace-file"}
+
+// FleetResult is the outcome of a command on one device in -all-devices mode
+type FleetResult struct {
+	Driver   string      `json:"driver"`
+	EID      string      `json:"eid,omitempty"`
+	Success  bool        `json:"success"`
+	Data     interface{} `json:"data,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Code     string      `json:"code,omitempty"`
+	Category string      `json:"category,omitempty"`
+}
+
+// fleetCommand reports whether a command may run across all devices:
+// read-only commands and notification processing
+func fleetCommand(command string) bool {
+	return readOnlyCommands[command] || command == "auto-notification"
+}
+
+// checkFleetFlags rejects single-device flags given on the command line together with -all-devices.
+// Driver and device settings from the config file are ignored instead, as discovery picks the devices.
+func checkFleetFlags() error {
+	var conflict string
+	flag.Visit(func(f *flag.Flag) {
+		if conflict == "" && slices.Contains(singleDeviceFlags, f.Name) {
+			conflict = f.Name
+		}
+	})
+	if conflict != "" {
+		return fmt.Errorf("%w -%s: cannot be combined with -all-devices", errInvalidFlag, conflict)
+	}
+	return nil
+}
+
+// runFleet runs a command on every discovered eUICC in parallel.
+// Results are keyed by the device path that answered.
+func runFleet(command string, args []string) map[string]FleetResult {
+	// Try the targets of each group in probe order until one opens,
+	// so a modem reachable over QMI and AT is only used once
+	var groups [][]deviceTarget
+	index := map[string]int{}
+	for _, t := range discoverDevices() {
+		if t.open == nil {
+			continue
+		}
+		i, ok := index[t.group]
+		if !ok {
+			i = len(groups)
+			index[t.group] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], t)
+	}
+
+	results := map[string]FleetResult{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, group := range groups {
+		wg.Add(1)
+		go func(group []deviceTarget) {
+			defer wg.Done()
+			path, result := runFleetGroup(command, args, group)
+			mu.Lock()
+			results[path] = result
+			mu.Unlock()
+		}(group)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// runFleetGroup runs the command on the first target of a group that opens
+func runFleetGroup(command string, args []string, group []deviceTarget) (string, FleetResult) {
+	var lastErr error
+	for _, t := range group {
+		client, err := openDeviceClient(t.open)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		defer client.Close()
+
+		result := FleetResult{Driver: t.info.Driver}
+		if eid, err := client.EID(); err == nil {
+			result.EID = hex.EncodeToString(eid)
+		}
+
+		data, err := runCommand(client, command, args)
+		if err != nil {
+			result.setError(err)
+		} else {
+			result.Success = true
+			result.Data = data
+		}
+		return t.info.Path, result
+	}
+
+	result := FleetResult{Driver: group[0].info.Driver}
+	result.setError(lastErr)
+	return group[0].info.Path, result
+}
+
+// setError records a classified error in the result
+func (r *FleetResult) setError(err error) {
+	ce := classifyError("", err)
+	r.Error, r.Code, r.Category = ce.Error(), ce.code, string(ce.category)
+}
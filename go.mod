@@ -6,5 +6,5 @@ require (
 	github.com/ElMostafaIdrassi/goscard v1.0.0 // indirect
 	github.com/KilimcininKorOglu/euicc-go v1.2.2 // indirect
 	github.com/ebitengine/purego v0.9.0 // indirect
-	golang.org/x/sys v0.37.0 // indirect
+	golang.org/x/sys v0.37.0
 )
@@ -0,0 +1,112 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/KilimcininKorOglu/euicc-go/apdu"
+)
+
+// errDeviceBusy is returned when another process holds the device lock
+var errDeviceBusy = errors.New("device busy")
+
+// lockPollInterval is how often a held lock is retried while waiting
+const lockPollInterval = 100 * time.Millisecond
+
+// createLockedDriver takes the advisory lock for the device, then creates the driver.
+// The lock is held until the channel is disconnected.
+func createLockedDriver(driverName, device string, slot int) (apdu.SmartCardChannel, error) {
+	// A reader selector is resolved once, so the lock and the channel name the same reader
+	if driverName == "ccid" {
+		reader, err := resolveCCIDReader(device)
+		if err != nil {
+			return nil, err
+		}
+		device = reader
+	}
+
+	key, err := deviceLockKey(driverName, device)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return createDriver(driverName, device, slot)
+	}
+
+	lock, err := lockDevice(key, time.Duration(*lockTimeout)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if *verbose && lock.path != "" {
+		log.Printf("Locked %s (%s)\n", key, lock.path)
+	}
+
+	channel, err := createDriver(driverName, device, slot)
+	if err != nil {
+		lock.release()
+		return nil, err
+	}
+	return &lockedChannel{SmartCardChannel: channel, lock: lock, key: key, driver: driverName, device: device, slot: slot}, nil
+}
+
+// deviceLockKey returns the resource a driver opens, or "" if it needs no lock
+func deviceLockKey(driverName, device string) (string, error) {
+	switch driverName {
+	case "qmi", "mbim":
+		if device == "" {
+			return "/dev/cdc-wdm0", nil
+		}
+		return device, nil
+	case "at":
+		return device, nil
+	case "ccid":
+		// device is the reader name resolved by createLockedDriver
+		return "ccid:" + device, nil
+	case "sim":
+		if device == "" {
+			device = simDefaultStatePath
+		}
+		return filepath.Abs(device)
+	default:
+		return "", nil
+	}
+}
+
+// lockFileName maps a device key to a lock file name, e.g. /dev/cdc-wdm0 -> hermes-euicc-dev_cdc-wdm0.lock
+func lockFileName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, strings.TrimPrefix(key, "/"))
+	return "hermes-euicc-" + name + ".lock"
+}
+
+func deviceBusyError(key string, timeout time.Duration) error {
+	return fmt.Errorf("%w: %s is in use by another process (waited %s, see -lock-timeout)", errDeviceBusy, key, timeout)
+}
+
+// lockedChannel releases the device lock when the channel is disconnected
+type lockedChannel struct {
+	apdu.SmartCardChannel
+	lock *deviceLock
+	key  string
+	// driver, device and slot the channel was created with, the CCID reader resolved to its name
+	driver string
+	device string
+	slot   int
+}
+
+func (l *lockedChannel) Disconnect() error {
+	err := l.SmartCardChannel.Disconnect()
+	l.lock.release()
+	return err
+}
@@ -0,0 +1,26 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import "time"
+
+// deviceLock is a no-op on platforms without flock(2).
+// On Windows, COM ports are opened exclusively by the system.
+type deviceLock struct {
+	path string
+}
+
+// lockDevice always succeeds on platforms without flock(2)
+func lockDevice(key string, timeout time.Duration) (*deviceLock, error) {
+	return &deviceLock{}, nil
+}
+
+// lockFile always succeeds on platforms without flock(2)
+func lockFile(path, key string, timeout time.Duration) (*deviceLock, error) {
+	return &deviceLock{}, nil
+}
+
+func (l *deviceLock) release() {}
@@ -0,0 +1,65 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// lockDir holds the lock files; /var/lock is shared by all users, /tmp is the fallback
+var lockDir = "/var/lock"
+
+// deviceLock is an flock(2) on a per-device lock file
+type deviceLock struct {
+	path string
+	file *os.File
+}
+
+// lockDevice takes an exclusive lock for key, waiting up to timeout for another process to release it
+func lockDevice(key string, timeout time.Duration) (*deviceLock, error) {
+	dir := lockDir
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		dir = "/tmp"
+	}
+	return lockFile(filepath.Join(dir, lockFileName(key)), key, timeout)
+}
+
+// lockFile takes an exclusive lock on the file at path, which guards key
+func lockFile(path, key string, timeout time.Duration) (*deviceLock, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return &deviceLock{path: path, file: file}, nil
+		}
+		if err != syscall.EWOULDBLOCK {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, deviceBusyError(key, timeout)
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// release unlocks the device; closing the file drops the flock
+func (l *deviceLock) release() {
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
@@ -0,0 +1,35 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutboxLockKeepsOtherProcessesOut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hermes-euicc", "outbox.json")
+
+	unlock, err := lockOutbox(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Another process opens the lock file on its own and has to wait
+	if _, err := lockFile(path+".lock", path, 0); !errors.Is(err, errDeviceBusy) {
+		t.Fatalf("outbox locked twice (%v)", err)
+	}
+	unlock()
+
+	other, err := lockFile(path+".lock", path, 0)
+	if err != nil {
+		t.Fatalf("outbox still locked after unlock: %v", err)
+	}
+	if _, err := lockOutbox(path); !errors.Is(err, errDeviceBusy) {
+		t.Errorf("outbox locked while another process holds it (%v)", err)
+	}
+	other.release()
+}
@@ -7,11 +7,13 @@ import (
 	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/KilimcininKorOglu/euicc-go/apdu"
@@ -27,9 +29,12 @@ var (
 
 // Response structures for JSON output
 type Response struct {
-	Success bool        `json:"success"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Success  bool          `json:"success"`
+	Data     interface{}   `json:"data,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Code     string        `json:"code,omitempty"`
+	Category string        `json:"category,omitempty"`
+	Details  *ErrorDetails `json:"details,omitempty"`
 }
 
 type EIDResponse struct {
@@ -49,10 +54,30 @@ type ProfileResponse struct {
 }
 
 type NotificationResponse struct {
-	SequenceNumber             int    `json:"sequence_number"`
-	ProfileManagementOperation int    `json:"profile_management_operation"`
-	Address                    string `json:"address,omitempty"`
-	ICCID                      string `json:"iccid,omitempty"`
+	SequenceNumber             int        `json:"sequence_number"`
+	ProfileManagementOperation int        `json:"profile_management_operation"`
+	Operation                  string     `json:"operation"`
+	Address                    string     `json:"address,omitempty"`
+	ICCID                      string     `json:"iccid,omitempty"`
+	FirstSeen                  *time.Time `json:"first_seen,omitempty"`
+	Payload                    string     `json:"payload,omitempty"`
+	PayloadSize                int        `json:"payload_size,omitempty"`
+}
+
+// notificationOperations names the NotificationEvent bits (SGP.22 2.4.4)
+var notificationOperations = map[int]string{
+	0x80: "install",
+	0x40: "enable",
+	0x20: "disable",
+	0x10: "delete",
+}
+
+// notificationOperation names a profile management operation
+func notificationOperation(op sgp22.NotificationEvent) string {
+	if name, ok := notificationOperations[int(op)]; ok {
+		return name
+	}
+	return "unknown"
 }
 
 type DiscoveryResponse struct {
@@ -67,8 +92,34 @@ type InfoResponse struct {
 }
 
 type DownloadResponse struct {
-	ISDPAID      string `json:"isdp_aid"`
-	Notification int    `json:"notification"`
+	ISDPAID            string                   `json:"isdp_aid"`
+	ICCID              string                   `json:"iccid,omitempty"`
+	Notification       int                      `json:"notification"`
+	NotificationSent   bool                     `json:"notification_sent,omitempty"`
+	NotificationQueued bool                     `json:"notification_queued,omitempty"`
+	Metadata           *ProfileMetadataResponse `json:"metadata,omitempty"`
+	Profile            *ProfileResponse         `json:"profile,omitempty"`
+	Message            string                   `json:"message,omitempty"`
+
+	// hasNotification is set when the download left an install notification, numbered sequenceNumber
+	hasNotification bool
+	sequenceNumber  sgp22.SequenceNumber
+}
+
+// ProfileMetadataResponse is the profile an SM-DP+ offers before it is installed
+type ProfileMetadataResponse struct {
+	ICCID               string   `json:"iccid"`
+	ProfileName         string   `json:"profile_name,omitempty"`
+	ServiceProviderName string   `json:"service_provider_name,omitempty"`
+	ProfileClass        string   `json:"profile_class,omitempty"`
+	Icon                string   `json:"icon,omitempty"`
+	IconFileType        string   `json:"icon_file_type,omitempty"`
+	ProfilePolicyRules  []string `json:"profile_policy_rules,omitempty"`
+}
+
+// DownloadRejectedResponse is the data of a download_rejected error
+type DownloadRejectedResponse struct {
+	Metadata *ProfileMetadataResponse `json:"metadata,omitempty"`
 }
 
 type ConfiguredAddressesResponse struct {
@@ -93,6 +144,7 @@ type AutoNotificationResponse struct {
 	Failed        int                      `json:"failed"`
 	ProcessedList []ProcessedNotification  `json:"processed_list"`
 	FailedList    []FailedNotification     `json:"failed_list"`
+	Queued        int                      `json:"queued"`
 }
 
 type ChipInfoResponse struct {
@@ -153,14 +205,72 @@ type AllowedOperatorResponse struct {
 	GID2 string `json:"gid2,omitempty"`
 }
 
+// commandHandler executes a command against an open client.
+// args holds the command-line arguments following the command name.
+type commandHandler func(client *lpa.Client, args []string) (interface{}, error)
+
+// commands maps every client-based command to its handler
+var commands = map[string]commandHandler{
+	"eid":                  handleEID,
+	"info":                 handleInfo,
+	"chip-info":            handleChipInfo,
+	"list":                 handleList,
+	"enable":               handleEnable,
+	"switch":               handleSwitch,
+	"disable":              handleDisable,
+	"delete":               handleDelete,
+	"nickname":             handleNickname,
+	"download":             handleDownload,
+	"discovery":            handleDiscovery,
+	"discover-download":    handleDiscoverDownload,
+	"download-batch":       handleDownloadBatch,
+	"notifications":        handleNotifications,
+	"notification-remove":  handleNotificationRemove,
+	"notification-handle":  handleNotificationHandle,
+	"auto-notification":    handleAutoNotification,
+	"notification-retry":   handleNotificationRetry,
+	"notification-export":  handleNotificationExport,
+	"notification-process": handleNotificationProcess,
+	"configured-addresses": handleConfiguredAddresses,
+	"set-default-dp":       handleSetDefaultDP,
+	"challenge":            handleChallenge,
+	"memory-reset":         handleMemoryReset,
+}
+
+// daemonCommands maps long-running commands that serve requests using one client
+var daemonCommands = map[string]func(client *lpa.Client, args []string) error{
+	"serve":    handleServe,
+	"ubus":     handleUbus,
+	"watchdog": handleWatchdog,
+}
+
+// readOnlyCommands lists commands that do not modify eUICC state
+var readOnlyCommands = map[string]bool{
+	"eid":                  true,
+	"info":                 true,
+	"chip-info":            true,
+	"list":                 true,
+	"discovery":            true,
+	"notifications":        true,
+	"configured-addresses": true,
+	"challenge":            true,
+}
+
 // Global flags
 var (
-	devicePath  = flag.String("device", "", "Device path (e.g., /dev/cdc-wdm0, /dev/ttyUSB2)")
-	driverType  = flag.String("driver", "", "Driver type: qmi, mbim, at, ccid (auto-detect if not specified)")
-	slotNumber  = flag.Int("slot", 0, "SIM slot number (0 = use config file)")
-	verbose     = flag.Bool("verbose", false, "Enable verbose logging")
-	timeout     = flag.Int("timeout", 0, "HTTP timeout in seconds (0 = use config file)")
-	configFile  = flag.String("config", "", "Config file path (default: auto-detect)")
+	devicePath   = flag.String("device", "", "Device path (e.g., /dev/cdc-wdm0, /dev/ttyUSB2)")
+	driverType   = flag.String("driver", "", "Driver type: qmi, mbim, at, ccid, sim, replay (auto-detect if not specified)")
+	slotNumber   = flag.Int("slot", 0, "SIM slot number (0 = use config file)")
+	verbose      = flag.Bool("verbose", false, "Enable verbose logging")
+	timeout      = flag.Int("timeout", 0, "HTTP timeout in seconds (0 = use config file)")
+	configFile   = flag.String("config", "", "Config file path (default: auto-detect)")
+	recordFile   = flag.String("record", "", "Record APDU exchanges to a trace file (replay with -driver replay)")
+	traceAPDU    = flag.Bool("trace-apdu", false, "Log every APDU exchange (matching IDs and confirmation codes are masked)")
+	traceFile    = flag.String("trace-file", "", "Write the -trace-apdu log to a file instead of stderr")
+	allDevices   = flag.Bool("all-devices", false, "Run the command on every discovered eUICC in parallel")
+	lockTimeout  = flag.Int("lock-timeout", -1, "Seconds to wait for a device in use by another process (-1 = use config file)")
+	outputFormat = flag.String("output", "json", "Output format: json, table, ndjson, yaml")
+	events       = flag.Bool("events", false, "Stream download progress as JSON lines, ending with the usual response")
 )
 
 func main() {
@@ -190,6 +300,17 @@ func main() {
 	if *timeout == 0 {
 		*timeout = uciConfig.Timeout
 	}
+	if *lockTimeout < 0 {
+		*lockTimeout = uciConfig.LockTimeout
+	}
+	if uciConfig.Outbox != "" {
+		outboxPath = uciConfig.Outbox
+	}
+
+	if format := *outputFormat; !outputFormats[format] {
+		*outputFormat = "json"
+		exitWithError(fmt.Errorf("%w %q for flag -output: use json, table, ndjson or yaml", errInvalidFlagValue, format))
+	}
 
 	if flag.NArg() < 1 {
 		printUsage()
@@ -206,109 +327,122 @@ func main() {
 	case "version":
 		handleVersion()
 		return
+	case "devices":
+		data, err := handleDevices(flag.Args()[1:])
+		if err != nil {
+			exitWithError(err)
+		}
+		outputSuccess(data)
+		return
+	case "parse-code":
+		data, err := handleParseCode(flag.Args()[1:])
+		if err != nil {
+			exitWithError(err)
+		}
+		outputSuccess(data)
+		return
+	case "notification-send":
+		data, err := handleNotificationSend(flag.Args()[1:])
+		if err != nil {
+			exitWithError(err)
+		}
+		outputSuccess(data)
+		return
 	}
 
 	// Validate command before initializing client
-	validCommands := map[string]bool{
-		"eid":                   true,
-		"info":                  true,
-		"chip-info":             true,
-		"list":                  true,
-		"enable":                true,
-		"disable":               true,
-		"delete":                true,
-		"nickname":              true,
-		"download":              true,
-		"discovery":             true,
-		"discover-download":     true,
-		"notifications":         true,
-		"notification-remove":   true,
-		"notification-handle":   true,
-		"auto-notification":     true,
-		"notification-process":  true,
-		"configured-addresses":  true,
-		"set-default-dp":        true,
-		"challenge":             true,
-		"memory-reset":          true,
-	}
-
-	if !validCommands[command] {
-		outputError(fmt.Errorf("unknown command: %s", command))
+	_, ok := commands[command]
+	daemon, isDaemon := daemonCommands[command]
+	if !ok && !isDaemon {
+		outputError(fmt.Errorf("%w: %s", errUnknownCommand, command))
 		fmt.Fprintln(os.Stderr, "\nRun 'hermes-euicc help' for usage information.")
-		os.Exit(1)
+		os.Exit(exitCodes[categoryValidation])
+	}
+
+	// Stream download progress; the final response is written as the last line
+	if *events {
+		if command != "download" || *allDevices {
+			exitWithError(fmt.Errorf("%w -events: only a single download streams events", errInvalidFlag))
+		}
+		if *outputFormat != "json" {
+			exitWithError(fmt.Errorf("%w -events: requires -output json", errInvalidFlag))
+		}
+		downloadEvents = os.Stdout
+	}
+
+	// Run the command on every discovered eUICC instead of a single device
+	if *allDevices {
+		if !ok || !fleetCommand(command) {
+			exitWithError(fmt.Errorf("command %s %w (read-only and auto-notification only)", command, errFleetUnsupported))
+		}
+		if err := checkFleetFlags(); err != nil {
+			exitWithError(err)
+		}
+		outputSuccess(runFleet(command, flag.Args()[1:]))
+		return
 	}
 
 	// Initialize LPA client
 	client, err := initClient()
 	if err != nil {
-		outputError(err)
-		os.Exit(1)
+		exitWithError(err)
 	}
 	defer client.Close()
 
+	// Daemons keep the client open and serve commands until they are stopped
+	if isDaemon {
+		if err := daemon(client, flag.Args()[1:]); err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
 	// Execute command
-	switch command {
-	case "eid":
-		handleEID(client)
-	case "info":
-		handleInfo(client)
-	case "chip-info":
-		handleChipInfo(client)
-	case "list":
-		handleList(client)
-	case "enable":
-		handleEnable(client)
-	case "disable":
-		handleDisable(client)
-	case "delete":
-		handleDelete(client)
-	case "nickname":
-		handleNickname(client)
-	case "download":
-		handleDownload(client)
-	case "discovery":
-		handleDiscovery(client)
-	case "discover-download":
-		handleDiscoverDownload(client)
-	case "notifications":
-		handleNotifications(client)
-	case "notification-remove":
-		handleNotificationRemove(client)
-	case "notification-handle":
-		handleNotificationHandle(client)
-	case "auto-notification":
-		handleAutoNotification(client)
-	case "notification-process":
-		handleNotificationProcess(client)
-	case "configured-addresses":
-		handleConfiguredAddresses(client)
-	case "set-default-dp":
-		handleSetDefaultDP(client)
-	case "challenge":
-		handleChallenge(client)
-	case "memory-reset":
-		handleMemoryReset(client)
-	default:
-		outputError(fmt.Errorf("unknown command: %s", command))
-		printUsage()
-		os.Exit(1)
+	standalone = true
+	interactive = stdinIsTerminal()
+	data, err := runCommand(client, command, flag.Args()[1:])
+	if err != nil {
+		exitWithError(err)
 	}
+
+	outputSuccess(data)
 }
 
 func initClient() (*lpa.Client, error) {
 	var channel apdu.SmartCardChannel
 	var err error
 
-	if *driverType != "" {
-		// User specified driver
-		channel, err = createDriver(*driverType, *devicePath, *slotNumber)
-	} else {
+	// Only the first open detects a driver, reopens use the device it found
+	open := func() (apdu.SmartCardChannel, error) {
+		if *driverType != "" {
+			// User specified driver
+			return createLockedDriver(*driverType, *devicePath, *slotNumber)
+		}
 		// Auto-detect driver
-		channel, err = autoDetectDriver(*devicePath, *slotNumber)
+		return autoDetectDriver(*devicePath, *slotNumber)
+	}
+
+	// A replay has nothing to reopen, its trace holds a single session
+	if *driverType == "replay" {
+		channel, err = open()
+	} else if deviceChannel, err = newReopenableChannel(open); err == nil {
+		channel = deviceChannel
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize driver: %w", err)
+		return nil, fmt.Errorf("%w: %w", errDriverInit, err)
+	}
+
+	if *recordFile != "" {
+		if channel, err = newRecordingChannel(channel, *recordFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if *traceAPDU {
+		if channel, err = newTracingChannel(channel, *traceFile); err != nil {
+			return nil, err
+		}
 	}
 
 	opts := &lpa.Options{
@@ -323,7 +457,7 @@ func createDriver(driverName, device string, slot int) (apdu.SmartCardChannel, e
 	switch driverName {
 	case "qmi":
 		if !qmiSupported {
-			return nil, fmt.Errorf("QMI driver not supported on this platform")
+			return nil, fmt.Errorf("QMI %w", errDriverUnsupported)
 		}
 		if device == "" {
 			device = "/dev/cdc-wdm0"
@@ -331,7 +465,7 @@ func createDriver(driverName, device string, slot int) (apdu.SmartCardChannel, e
 		return newQMIDriver(device, uint8(slot))
 	case "mbim":
 		if !mbimSupported {
-			return nil, fmt.Errorf("MBIM driver not supported on this platform")
+			return nil, fmt.Errorf("MBIM %w", errDriverUnsupported)
 		}
 		if device == "" {
 			device = "/dev/cdc-wdm0"
@@ -339,59 +473,50 @@ func createDriver(driverName, device string, slot int) (apdu.SmartCardChannel, e
 		return newMBIMDriver(device, uint8(slot))
 	case "at":
 		if !atSupported {
-			return nil, fmt.Errorf("AT driver not supported on this platform")
+			return nil, fmt.Errorf("AT %w", errDriverUnsupported)
 		}
 		if device == "" {
-			return nil, fmt.Errorf("device path required for AT driver")
+			return nil, fmt.Errorf("%w for AT driver", errDeviceRequired)
 		}
 		return newATDriver(device)
 	case "ccid":
-		return initCCIDDriver()
+		return initCCIDDriver(device)
+	case "sim":
+		return newSimDriver(device)
+	case "replay":
+		return newReplayDriver(device)
 	default:
-		return nil, fmt.Errorf("unknown driver type: %s", driverName)
+		return nil, fmt.Errorf("%w: %s", errUnknownDriver, driverName)
 	}
 }
 
 func autoDetectDriver(device string, slot int) (apdu.SmartCardChannel, error) {
-	// Try QMI
-	if qmiSupported && (device == "" || device == "/dev/cdc-wdm0") {
-		if ch, err := newQMIDriver("/dev/cdc-wdm0", uint8(slot)); err == nil {
-			if *verbose {
-				log.Println("Auto-detected: QMI driver")
-			}
-			return ch, nil
+	// Try QMI, MBIM and AT on enumerated modem nodes (platform-specific)
+	for _, c := range modemCandidates(device) {
+		ch, err := createLockedDriver(c.Driver, c.Path, slot)
+		if errors.Is(err, errDeviceBusy) {
+			// A modem is there but in use; probing its other interfaces would interfere
+			return nil, err
 		}
-	}
-
-	// Try MBIM
-	if mbimSupported && (device == "" || device == "/dev/cdc-wdm0") {
-		if ch, err := newMBIMDriver("/dev/cdc-wdm0", uint8(slot)); err == nil {
+		if err != nil {
 			if *verbose {
-				log.Println("Auto-detected: MBIM driver")
+				log.Printf("Probe %s on %s failed: %v\n", c.Driver, c.Path, err)
 			}
-			return ch, nil
+			continue
 		}
-	}
-
-	// Try AT on common devices (platform-specific)
-	if atSupported {
-		atDevices := defaultATDevices()
-		if device != "" {
-			atDevices = []string{device}
-		}
-		for _, dev := range atDevices {
-			if ch, err := newATDriver(dev); err == nil {
-				if *verbose {
-					log.Printf("Auto-detected: AT driver on %s\n", dev)
-				}
-				return ch, nil
+		if *verbose {
+			detail := ""
+			if c.VendorID != "" {
+				detail = fmt.Sprintf(" (%s, USB %s:%s)", c.KernelDriver, c.VendorID, c.ProductID)
 			}
+			log.Printf("Auto-detected: %s driver on %s%s\n", strings.ToUpper(c.Driver), c.Path, detail)
 		}
+		return ch, nil
 	}
 
 	// Try CCID (only on supported platforms)
 	if ccidSupported {
-		if ch, err := initCCIDDriver(); err == nil {
+		if ch, err := createLockedDriver("ccid", device, slot); err == nil {
 			if *verbose {
 				log.Printf("Auto-detected: CCID driver\n")
 			}
@@ -399,64 +524,63 @@ func autoDetectDriver(device string, slot int) (apdu.SmartCardChannel, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("no compatible driver found")
+	return nil, errNoDriver
 }
 
 // Command handlers
 
 func handleVersion() {
-	outputSuccess(map[string]string{
+	outputSuccess(versionInfo())
+}
+
+func versionInfo() map[string]string {
+	return map[string]string{
 		"name":      "Hermes eUICC Manager",
 		"version":   fmt.Sprintf("%s-%s", Version, Release),
 		"copyright": "Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>",
 		"license":   "MIT",
-	})
+	}
 }
 
-func handleEID(client *lpa.Client) {
+func handleEID(client *lpa.Client, args []string) (interface{}, error) {
 	eid, err := client.EID()
 	if err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, cardError(err)
 	}
 
-	outputSuccess(EIDResponse{
+	return EIDResponse{
 		EID: hex.EncodeToString(eid),
-	})
+	}, nil
 }
 
-func handleInfo(client *lpa.Client) {
+func handleInfo(client *lpa.Client, args []string) (interface{}, error) {
 	eid, err := client.EID()
 	if err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, cardError(err)
 	}
 
 	info1, err := client.EUICCInfo1()
 	if err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, err
 	}
 
 	info2, err := client.EUICCInfo2()
 	if err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, err
 	}
 
-	outputSuccess(InfoResponse{
+	return InfoResponse{
 		EID:        hex.EncodeToString(eid),
 		EUICCInfo1: hex.EncodeToString(info1.Bytes()),
 		EUICCInfo2: hex.EncodeToString(info2.Bytes()),
-	})
+	}, nil
 }
 
-func handleChipInfo(client *lpa.Client) {
+func handleChipInfo(client *lpa.Client, args []string) (interface{}, error) {
 	// Get chip info using library's ChipInfo function
 	chipInfo, err := client.ChipInfo()
 	if err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, cardError(err)
 	}
 
 	// Build response
@@ -523,162 +647,251 @@ func handleChipInfo(client *lpa.Client) {
 		}
 	}
 
-	outputSuccess(response)
+	return response, nil
 }
 
-func handleList(client *lpa.Client) {
+func handleList(client *lpa.Client, args []string) (interface{}, error) {
 	profiles, err := client.ListProfile(nil, nil)
 	if err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, cardError(err)
 	}
 
 	response := make([]ProfileResponse, 0, len(profiles))
 	for _, p := range profiles {
-		pr := ProfileResponse{
-			ICCID:               p.ICCID.String(),
-			ISDPAID:             p.ISDPAID.String(),
-			ProfileState:        int(p.ProfileState),
-			ProfileName:         p.ProfileName,
-			ProfileNickname:     p.ProfileNickname,
-			ServiceProviderName: p.ServiceProviderName,
-			ProfileClass:        p.ProfileClass.String(),
-		}
-		if p.Icon.Valid() {
-			pr.Icon = p.Icon.String()
-			pr.IconFileType = p.Icon.FileType()
+		response = append(response, profileResponse(p))
+	}
+
+	return response, nil
+}
+
+// profileMetadata converts the metadata an SM-DP+ sends before installing a profile
+func profileMetadata(p *sgp22.ProfileInfo) *ProfileMetadataResponse {
+	m := &ProfileMetadataResponse{
+		ICCID:               p.ICCID.String(),
+		ProfileName:         p.ProfileName,
+		ServiceProviderName: p.ServiceProviderName,
+		ProfileClass:        p.ProfileClass.String(),
+		ProfilePolicyRules:  pprNames(p.ProfilePolicyRules),
+	}
+	if p.Icon.Valid() {
+		m.Icon = p.Icon.String()
+		m.IconFileType = p.Icon.FileType()
+	}
+	return m
+}
+
+// pprNames lists the rules set in a PprIds bit string (SGP.22 section 2.4.4)
+func pprNames(rules sgp22.ProfilePolicyRules) []string {
+	var names []string
+	for i, name := range []string{"pprUpdateControl", "ppr1", "ppr2"} {
+		if uint8(rules)&(0x80>>i) != 0 {
+			names = append(names, name)
 		}
-		response = append(response, pr)
 	}
+	return names
+}
 
-	outputSuccess(response)
+// downloadRejectedError reports a download that was not confirmed, with the profile that was offered
+func downloadRejectedError(offered *ProfileMetadataResponse) error {
+	err := errors.New("download rejected by user")
+	if !interactive {
+		err = errors.New("download not confirmed: use --confirm or run from a terminal")
+	}
+	return &commandError{
+		category: categoryValidation,
+		code:     "download_rejected",
+		data:     DownloadRejectedResponse{Metadata: offered},
+		err:      err,
+	}
 }
 
-func handleEnable(client *lpa.Client) {
-	if flag.NArg() < 2 {
-		outputError(fmt.Errorf("usage: enable <iccid>"))
-		os.Exit(1)
+// profileResponse converts profile information from the eUICC or SM-DP+ metadata
+func profileResponse(p *sgp22.ProfileInfo) ProfileResponse {
+	pr := ProfileResponse{
+		ICCID:               p.ICCID.String(),
+		ISDPAID:             p.ISDPAID.String(),
+		ProfileState:        int(p.ProfileState),
+		ProfileName:         p.ProfileName,
+		ProfileNickname:     p.ProfileNickname,
+		ServiceProviderName: p.ServiceProviderName,
+		ProfileClass:        p.ProfileClass.String(),
+	}
+	if p.Icon.Valid() {
+		pr.Icon = p.Icon.String()
+		pr.IconFileType = p.Icon.FileType()
+	}
+	return pr
+}
+
+func handleEnable(client *lpa.Client, args []string) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("%w: enable <iccid|selector>", errUsage)
 	}
 
-	iccid, err := sgp22.NewICCID(flag.Arg(1))
+	iccid, err := resolveProfile(client, args[0])
 	if err != nil {
-		outputError(fmt.Errorf("invalid ICCID: %w", err))
-		os.Exit(1)
+		return nil, err
 	}
 
 	if err := client.EnableProfile(iccid, true); err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, cardError(err)
 	}
 
-	outputSuccess(map[string]string{
+	return map[string]string{
 		"message": "profile enabled successfully",
-		"iccid":   flag.Arg(1),
-	})
+		"iccid":   iccid.String(),
+	}, nil
 }
 
-func handleDisable(client *lpa.Client) {
-	if flag.NArg() < 2 {
-		outputError(fmt.Errorf("usage: disable <iccid>"))
-		os.Exit(1)
+func handleDisable(client *lpa.Client, args []string) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("%w: disable <iccid|selector>", errUsage)
 	}
 
-	iccid, err := sgp22.NewICCID(flag.Arg(1))
+	iccid, err := resolveProfile(client, args[0])
 	if err != nil {
-		outputError(fmt.Errorf("invalid ICCID: %w", err))
-		os.Exit(1)
+		return nil, err
 	}
 
 	if err := client.DisableProfile(iccid, true); err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, cardError(err)
 	}
 
-	outputSuccess(map[string]string{
+	return map[string]string{
 		"message": "profile disabled successfully",
-		"iccid":   flag.Arg(1),
-	})
+		"iccid":   iccid.String(),
+	}, nil
 }
 
-func handleDelete(client *lpa.Client) {
-	if flag.NArg() < 2 {
-		outputError(fmt.Errorf("usage: delete <iccid>"))
-		os.Exit(1)
+func handleDelete(client *lpa.Client, args []string) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("%w: delete <iccid|selector>", errUsage)
 	}
 
-	iccid, err := sgp22.NewICCID(flag.Arg(1))
+	iccid, err := resolveProfile(client, args[0])
 	if err != nil {
-		outputError(fmt.Errorf("invalid ICCID: %w", err))
-		os.Exit(1)
+		return nil, err
 	}
 
 	if err := client.DeleteProfile(iccid); err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, cardError(err)
 	}
 
-	outputSuccess(map[string]string{
+	return map[string]string{
 		"message": "profile deleted successfully",
-		"iccid":   flag.Arg(1),
-	})
+		"iccid":   iccid.String(),
+	}, nil
 }
 
-func handleNickname(client *lpa.Client) {
-	if flag.NArg() < 3 {
-		outputError(fmt.Errorf("usage: nickname <iccid> <nickname>"))
-		os.Exit(1)
+func handleNickname(client *lpa.Client, args []string) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("%w: nickname <iccid|selector> <nickname>", errUsage)
 	}
 
-	iccid, err := sgp22.NewICCID(flag.Arg(1))
+	iccid, err := resolveProfile(client, args[0])
 	if err != nil {
-		outputError(fmt.Errorf("invalid ICCID: %w", err))
-		os.Exit(1)
+		return nil, err
 	}
 
-	nickname := flag.Arg(2)
+	nickname := args[1]
 
 	if err := client.SetNickname(iccid, nickname); err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, cardError(err)
 	}
 
-	outputSuccess(map[string]string{
+	return map[string]string{
 		"message":  "nickname set successfully",
-		"iccid":    flag.Arg(1),
+		"iccid":    iccid.String(),
 		"nickname": nickname,
-	})
+	}, nil
 }
 
-func handleDownload(client *lpa.Client) {
-	var (
-		activationCode   = flag.String("code", "", "Activation code (LPA:1$smdp.io$MATCHING-ID)")
-		confirmationCode = flag.String("confirmation-code", "", "Confirmation code")
-		imei             = flag.String("imei", "", "IMEI")
-		autoConfirm      = flag.Bool("confirm", false, "Auto-confirm download")
-	)
-
-	downloadFlags := flag.NewFlagSet("download", flag.ExitOnError)
-	downloadFlags.StringVar(activationCode, "code", "", "Activation code")
-	downloadFlags.StringVar(confirmationCode, "confirmation-code", "", "Confirmation code")
-	downloadFlags.StringVar(imei, "imei", "", "IMEI")
-	downloadFlags.BoolVar(autoConfirm, "confirm", false, "Auto-confirm download")
-	downloadFlags.Parse(flag.Args()[1:])
+func handleDownload(client *lpa.Client, args []string) (interface{}, error) {
+	downloadFlags := flag.NewFlagSet("download", flag.ContinueOnError)
+	activationCode := downloadFlags.String("code", "", "Activation code (LPA:1$smdp.io$MATCHING-ID)")
+	qrImage := downloadFlags.String("qr", "", "Read the activation code from a PNG or JPEG image of its QR code")
+	confirmationCode := downloadFlags.String("confirmation-code", "", "Confirmation code (visible in ps, prefer --confirmation-code-fd)")
+	confirmationCodeFD := downloadFlags.Int("confirmation-code-fd", -1, "Read the confirmation code from this file descriptor")
+	imei := downloadFlags.String("imei", "", "IMEI")
+	autoConfirm := downloadFlags.Bool("confirm", false, "Confirm the download without prompting")
+	nickname := downloadFlags.String("nickname", "", "Set this nickname on the new profile")
+	enable := downloadFlags.Bool("enable", false, "Enable the new profile")
+	sendNotifications := downloadFlags.Bool("send-notifications", false, "Send the install notification to the SM-DP+ and remove it")
+	if err := downloadFlags.Parse(args); err != nil {
+		return nil, markError(errInvalidFlag, err)
+	}
+
+	if *qrImage != "" {
+		if *activationCode != "" {
+			return nil, fmt.Errorf("%w -qr: give either --code or --qr", errInvalidFlag)
+		}
+		if !standalone {
+			return nil, fmt.Errorf("%w -qr: not available over the API", errInvalidFlag)
+		}
+		code, err := decodeQRFile(*qrImage)
+		if err != nil {
+			return nil, err
+		}
+		*activationCode = code
+	}
 
 	if *activationCode == "" {
-		outputError(fmt.Errorf("activation code required: use --code"))
-		os.Exit(1)
+		return nil, fmt.Errorf("%w: use --code or --qr", errActivationCodeRequired)
 	}
 
-	ac := &lpa.ActivationCode{}
-	if err := ac.UnmarshalText([]byte(*activationCode)); err != nil {
-		outputError(fmt.Errorf("invalid activation code: %w", err))
-		os.Exit(1)
+	code, err := resolveConfirmationCode(*confirmationCode, *confirmationCodeFD)
+	if err != nil {
+		return nil, err
 	}
 
-	if *imei != "" {
-		ac.IMEI = *imei
+	dr, err := downloadProfile(client, downloadRequest{
+		activationCode:   *activationCode,
+		confirmationCode: code,
+		imei:             *imei,
+		confirm:          *autoConfirm,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if *nickname != "" || *enable || *sendNotifications {
+		err = finishDownload(client, &dr, postDownload{
+			nickname:          *nickname,
+			enable:            *enable,
+			sendNotifications: *sendNotifications,
+			reopen:            reopenDevice,
+		})
+	}
+	return dr, err
+}
+
+// downloadRequest is one profile download, from the download command or a batch manifest
+type downloadRequest struct {
+	activationCode   string
+	confirmationCode string
+	imei             string
+	confirm          bool
+}
+
+// downloadProfile checks the activation code, then downloads and installs the profile
+func downloadProfile(client *lpa.Client, req downloadRequest) (DownloadResponse, error) {
+	// Catch malformed codes before contacting the SM-DP+
+	ac, _, err := prepareActivationCode(req.activationCode)
+	if err != nil {
+		return DownloadResponse{}, err
+	}
+
+	if req.imei != "" {
+		ac.IMEI = req.imei
 	}
 
+	code := req.confirmationCode
+	redactInTrace(ac.MatchingID, code)
+
+	// The offered profile is reported whether it is installed or rejected
+	var offered *ProfileMetadataResponse
+	var rejected bool
+
 	ctx := context.Background()
 	opts := &lpa.DownloadOptions{
 		OnProgress: func(stage lpa.DownloadStage) {
@@ -687,39 +900,166 @@ func handleDownload(client *lpa.Client) {
 			}
 		},
 		OnConfirm: func(metadata *sgp22.ProfileInfo) bool {
-			return *autoConfirm
+			if metadata != nil {
+				offered = profileMetadata(metadata)
+			}
+			switch {
+			case req.confirm:
+				return true
+			case interactive && offered != nil:
+				rejected = !confirmDownload(offered)
+			default:
+				rejected = true
+			}
+			return !rejected
 		},
 		OnEnterConfirmationCode: func() string {
-			return *confirmationCode
+			if code == "" && interactive {
+				code = promptConfirmationCode()
+				redactInTrace(code)
+			}
+			return code
 		},
 	}
+	if downloadEvents != nil {
+		opts = downloadEventOptions(opts)
+		emitDownloadEvent(DownloadEvent{Event: "authenticate", SMDP: ac.SMDP.String()})
+	}
 
+	// A rejection cancels the session, the SM-DP+ is told the end user rejected the profile
 	result, err := client.DownloadProfile(ctx, ac, opts)
+	if rejected {
+		if err != nil && *verbose {
+			log.Printf("Download cancelled: %v\n", err)
+		}
+		err = downloadRejectedError(offered)
+	} else {
+		err = smdpError(err)
+	}
+	emitDownloadResult(err)
 	if err != nil {
-		outputError(err)
-		os.Exit(1)
+		return DownloadResponse{}, err
 	}
 
 	dr := DownloadResponse{
-		ISDPAID: result.ISDPAID().String(),
+		ISDPAID:  result.ISDPAID().String(),
+		Metadata: offered,
+	}
+	if offered != nil {
+		dr.ICCID = offered.ICCID
 	}
 	if result.Notification != nil {
 		dr.Notification = int(result.Notification.ProfileManagementOperation)
+		dr.hasNotification = true
+		dr.sequenceNumber = result.Notification.SequenceNumber
+		if dr.ICCID == "" {
+			dr.ICCID = result.Notification.ICCID.String()
+		}
 	}
 
-	outputSuccess(dr)
+	return dr, nil
 }
 
-func handleDiscovery(client *lpa.Client) {
-	var (
-		server = flag.String("server", "", "SM-DS server address (default: lpa.ds.gsma.com)")
-		imei   = flag.String("imei", "", "IMEI for authentication")
-	)
+// postDownload lists the steps to run on a profile once it is installed
+type postDownload struct {
+	nickname          string
+	enable            bool
+	sendNotifications bool
+	reopen            func() error // connects to the device again after enable refreshed the eUICC
+}
+
+// finishDownload sets the nickname of a new profile, sends its install notification and enables it.
+// The notification is sent before enabling, which may switch the network connection.
+// Errors carry the download response, since the profile stays installed.
+func finishDownload(client *lpa.Client, dr *DownloadResponse, steps postDownload) error {
+	if dr.ICCID == "" {
+		dr.ICCID = installedICCID(client, dr.ISDPAID)
+	}
+	iccid, err := sgp22.NewICCID(dr.ICCID)
+	if err != nil {
+		return installedError(dr, "download", errors.New("the ICCID of the new profile is unknown"))
+	}
+
+	if steps.nickname != "" {
+		if err := client.SetNickname(iccid, steps.nickname); err != nil {
+			return installedError(dr, "nickname", fmt.Errorf("failed to set nickname: %w", cardError(err)))
+		}
+	}
+
+	if steps.sendNotifications && !dr.hasNotification {
+		dr.Message = "the eUICC left no install notification, nothing was sent"
+	}
+	if steps.sendNotifications && dr.hasNotification {
+		results, err := client.ProcessNotifications(&lpa.ProcessNotificationsOptions{AutoRemove: true}, dr.sequenceNumber)
+		if err == nil && len(results) > 0 && !results[0].Success {
+			err = results[0].Error
+		}
+		if err = smdpError(err); err != nil {
+			// notification-retry sends it later, the remaining steps still run
+			failed := []FailedNotification{{SequenceNumber: int(dr.sequenceNumber), Error: err.Error()}}
+			if queueErr := queueFailedNotifications(client, failed); queueErr != nil {
+				return installedError(dr, "notification-handle", fmt.Errorf("failed to send install notification %d: %w (not queued: %v)", dr.sequenceNumber, err, queueErr))
+			}
+			dr.NotificationQueued = true
+			dr.Message = fmt.Sprintf("install notification %d not sent, queued for notification-retry: %v", dr.sequenceNumber, err)
+		} else {
+			dr.NotificationSent = true
+		}
+	}
+
+	if steps.enable {
+		if err := client.EnableProfile(iccid, true); err != nil {
+			return installedError(dr, "enable", fmt.Errorf("failed to enable profile: %w", cardError(err)))
+		}
+		reopenAfterRefresh(steps.reopen)
+	}
+
+	profiles, err := client.ListProfile(nil, nil)
+	if err != nil {
+		return installedError(dr, "list", fmt.Errorf("failed to read new profile: %w", cardError(err)))
+	}
+	for _, p := range profiles {
+		if p.ICCID.String() == dr.ICCID {
+			pr := profileResponse(p)
+			dr.Profile = &pr
+		}
+	}
+	return nil
+}
+
+// installedError classifies err as an error of command and attaches the download response to it
+func installedError(dr *DownloadResponse, command string, err error) error {
+	ce := classifyError(command, err)
+	return &commandError{
+		category: ce.category,
+		code:     ce.code,
+		details:  ce.details,
+		data:     *dr,
+		err:      fmt.Errorf("profile installed, but %w", err),
+	}
+}
+
+// installedICCID looks up the ICCID of the profile in an ISD-P
+func installedICCID(client *lpa.Client, isdpAID string) string {
+	profiles, err := client.ListProfile(nil, nil)
+	if err != nil {
+		return ""
+	}
+	for _, p := range profiles {
+		if strings.EqualFold(p.ISDPAID.String(), isdpAID) {
+			return p.ICCID.String()
+		}
+	}
+	return ""
+}
 
-	discoveryFlags := flag.NewFlagSet("discovery", flag.ExitOnError)
-	discoveryFlags.StringVar(server, "server", "", "SM-DS server address")
-	discoveryFlags.StringVar(imei, "imei", "", "IMEI")
-	discoveryFlags.Parse(flag.Args()[1:])
+func handleDiscovery(client *lpa.Client, args []string) (interface{}, error) {
+	discoveryFlags := flag.NewFlagSet("discovery", flag.ContinueOnError)
+	server := discoveryFlags.String("server", "", "SM-DS server address (default: lpa.ds.gsma.com)")
+	imei := discoveryFlags.String("imei", "", "IMEI for authentication")
+	if err := discoveryFlags.Parse(args); err != nil {
+		return nil, markError(errInvalidFlag, err)
+	}
 
 	// Prepare discovery options
 	opts := &lpa.DiscoverProfilesOptions{}
@@ -733,8 +1073,7 @@ func handleDiscovery(client *lpa.Client) {
 	if *imei != "" {
 		imeiBytes, err := sgp22.NewIMEI(*imei)
 		if err != nil {
-			outputError(fmt.Errorf("invalid IMEI: %w", err))
-			os.Exit(1)
+			return nil, fmt.Errorf("%w: %w", errInvalidIMEI, err)
 		}
 		opts.IMEI = imeiBytes
 	}
@@ -742,8 +1081,7 @@ func handleDiscovery(client *lpa.Client) {
 	// Use library's DiscoverProfiles function
 	profiles, err := client.DiscoverProfiles(opts)
 	if err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, smdpError(err)
 	}
 
 	// Convert to response format
@@ -755,19 +1093,16 @@ func handleDiscovery(client *lpa.Client) {
 		}
 	}
 
-	outputSuccess(response)
+	return response, nil
 }
 
-func handleDiscoverDownload(client *lpa.Client) {
-	var (
-		server = flag.String("server", "", "SM-DS server address (default: lpa.ds.gsma.com)")
-		imei   = flag.String("imei", "", "IMEI for authentication")
-	)
-
-	discoveryFlags := flag.NewFlagSet("discover-download", flag.ExitOnError)
-	discoveryFlags.StringVar(server, "server", "", "SM-DS server address")
-	discoveryFlags.StringVar(imei, "imei", "", "IMEI")
-	discoveryFlags.Parse(flag.Args()[1:])
+func handleDiscoverDownload(client *lpa.Client, args []string) (interface{}, error) {
+	discoveryFlags := flag.NewFlagSet("discover-download", flag.ContinueOnError)
+	server := discoveryFlags.String("server", "", "SM-DS server address (default: lpa.ds.gsma.com)")
+	imei := discoveryFlags.String("imei", "", "IMEI for authentication")
+	if err := discoveryFlags.Parse(args); err != nil {
+		return nil, markError(errInvalidFlag, err)
+	}
 
 	// Prepare discovery options
 	discoveryOpts := &lpa.DiscoverProfilesOptions{}
@@ -781,8 +1116,7 @@ func handleDiscoverDownload(client *lpa.Client) {
 	if *imei != "" {
 		imeiBytes, err := sgp22.NewIMEI(*imei)
 		if err != nil {
-			outputError(fmt.Errorf("invalid IMEI: %w", err))
-			os.Exit(1)
+			return nil, fmt.Errorf("%w: %w", errInvalidIMEI, err)
 		}
 		discoveryOpts.IMEI = imeiBytes
 	}
@@ -791,109 +1125,193 @@ func handleDiscoverDownload(client *lpa.Client) {
 	ctx := context.Background()
 	result, err := client.DiscoverAndDownload(ctx, discoveryOpts, nil)
 	if err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, smdpError(err)
 	}
 
 	// Check if a profile was downloaded
 	if result == nil {
-		outputSuccess(map[string]interface{}{
+		return map[string]interface{}{
 			"message": "no profiles available for download",
-		})
-		return
+		}, nil
 	}
 
-	outputSuccess(map[string]interface{}{
+	return map[string]interface{}{
 		"message": "profile downloaded successfully",
-	})
+	}, nil
 }
 
-func handleNotifications(client *lpa.Client) {
+func handleNotifications(client *lpa.Client, args []string) (interface{}, error) {
+	listFlags := flag.NewFlagSet("notifications", flag.ContinueOnError)
+	iccid := listFlags.String("iccid", "", "Only notifications of this ICCID")
+	operation := listFlags.String("operation", "", "Only this operation: install, enable, disable or delete")
+	address := listFlags.String("address", "", "Only notifications for this SM-DP+ address")
+	payload := listFlags.Bool("payload", false, "Include the signed notification as hex and its size")
+	if err := listFlags.Parse(args); err != nil {
+		return nil, markError(errInvalidFlag, err)
+	}
+	if *operation != "" && !isNotificationOperation(*operation) {
+		return nil, fmt.Errorf("%w %q for flag -operation: use install, enable, disable or delete", errInvalidFlagValue, *operation)
+	}
+
 	notifications, err := client.ListNotification()
 	if err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, cardError(err)
 	}
 
 	response := make([]NotificationResponse, 0, len(notifications))
 	for _, n := range notifications {
-		response = append(response, NotificationResponse{
+		nr := NotificationResponse{
 			SequenceNumber:             int(n.SequenceNumber),
 			ProfileManagementOperation: int(n.ProfileManagementOperation),
+			Operation:                  notificationOperation(n.ProfileManagementOperation),
 			Address:                    n.Address,
 			ICCID:                      n.ICCID.String(),
-		})
+		}
+		if (*iccid != "" && nr.ICCID != *iccid) ||
+			(*operation != "" && nr.Operation != *operation && strconv.Itoa(nr.ProfileManagementOperation) != *operation) ||
+			(*address != "" && !strings.EqualFold(nr.Address, *address)) {
+			continue
+		}
+		response = append(response, nr)
+	}
+	if len(response) == 0 {
+		return response, nil
 	}
 
-	outputSuccess(response)
+	if *payload {
+		pending, err := client.RetrieveNotificationList(nil)
+		if err != nil {
+			return nil, cardError(err)
+		}
+		payloads := make(map[int][]byte, len(pending))
+		for _, p := range pending {
+			payloads[int(p.Notification.SequenceNumber)] = p.PendingNotification.Bytes()
+		}
+		for i := range response {
+			data := payloads[response[i].SequenceNumber]
+			response[i].Payload, response[i].PayloadSize = hex.EncodeToString(data), len(data)
+		}
+	}
+
+	// The card keeps no event time. first_seen is when the outbox first recorded a notification
+	// (notification-retry, or a failed send queued by download or auto-notification), and is left
+	// out for notifications the outbox has no record of.
+	if _, err := os.Stat(outboxPath); err == nil {
+		addFirstSeen(client, response)
+	}
+
+	return response, nil
 }
 
-func handleNotificationRemove(client *lpa.Client) {
-	if flag.NArg() < 2 {
-		outputError(fmt.Errorf("usage: notification-remove <sequence-number>"))
-		os.Exit(1)
+// addFirstSeen sets first_seen from the outbox. A listing does not fail over it: when the outbox
+// or the EID cannot be read, first_seen is left out.
+func addFirstSeen(client *lpa.Client, response []NotificationResponse) {
+	box, err := loadOutbox(outboxPath)
+	if err != nil {
+		if *verbose {
+			log.Printf("Outbox not read, first_seen left out: %v\n", err)
+		}
+		return
+	}
+	eid, err := client.EID()
+	if err != nil {
+		if *verbose {
+			log.Printf("EID not read, first_seen left out: %v\n", err)
+		}
+		return
+	}
+	for _, e := range box.forEID(hex.EncodeToString(eid)) {
+		if e.FirstSeen.IsZero() {
+			continue
+		}
+		for i := range response {
+			if response[i].SequenceNumber == e.SequenceNumber && response[i].ICCID == e.ICCID &&
+				response[i].ProfileManagementOperation == e.ProfileManagementOperation {
+				firstSeen := e.FirstSeen
+				response[i].FirstSeen = &firstSeen
+			}
+		}
+	}
+}
+
+// isNotificationOperation reports whether value is an operation name or its number
+func isNotificationOperation(value string) bool {
+	for number, name := range notificationOperations {
+		if value == name || value == strconv.Itoa(number) {
+			return true
+		}
+	}
+	return false
+}
+
+func handleNotificationRemove(client *lpa.Client, args []string) (interface{}, error) {
+	removeFlags := flag.NewFlagSet("notification-remove", flag.ContinueOnError)
+	fromFile := removeFlags.String("from-file", "", "Remove the notifications of this file that notification-send delivered")
+	if err := removeFlags.Parse(args); err != nil {
+		return nil, markError(errInvalidFlag, err)
+	}
+	if *fromFile != "" {
+		if !standalone {
+			return nil, fmt.Errorf("notification-remove --from-file is %w, the file is read locally", errNotOverAPI)
+		}
+		return removeSentNotifications(client, *fromFile)
+	}
+	if removeFlags.NArg() < 1 {
+		return nil, fmt.Errorf("%w: notification-remove <sequence-number> | --from-file <file>", errUsage)
 	}
 
 	var seqNum int
-	if _, err := fmt.Sscanf(flag.Arg(1), "%d", &seqNum); err != nil {
-		outputError(fmt.Errorf("invalid sequence number: %w", err))
-		os.Exit(1)
+	if _, err := fmt.Sscanf(removeFlags.Arg(0), "%d", &seqNum); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidSequenceNumber, err)
 	}
 
 	if err := client.RemoveNotificationFromList(sgp22.SequenceNumber(seqNum)); err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, cardError(err)
 	}
 
-	outputSuccess(map[string]interface{}{
+	return map[string]interface{}{
 		"message":         "notification removed successfully",
 		"sequence_number": seqNum,
-	})
+	}, nil
 }
 
-func handleNotificationHandle(client *lpa.Client) {
-	if flag.NArg() < 2 {
-		outputError(fmt.Errorf("usage: notification-handle <sequence-number>"))
-		os.Exit(1)
+func handleNotificationHandle(client *lpa.Client, args []string) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("%w: notification-handle <sequence-number>", errUsage)
 	}
 
 	var seqNum int
-	if _, err := fmt.Sscanf(flag.Arg(1), "%d", &seqNum); err != nil {
-		outputError(fmt.Errorf("invalid sequence number: %w", err))
-		os.Exit(1)
+	if _, err := fmt.Sscanf(args[0], "%d", &seqNum); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidSequenceNumber, err)
 	}
 
 	notifications, err := client.RetrieveNotificationList(sgp22.SequenceNumber(seqNum))
 	if err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, cardError(err)
 	}
 
 	if len(notifications) == 0 {
-		outputError(fmt.Errorf("notification not found"))
-		os.Exit(1)
+		return nil, errNotificationNotFound
 	}
 
 	if err := client.HandleNotification(notifications[0]); err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, smdpError(err)
 	}
 
-	outputSuccess(map[string]interface{}{
+	return map[string]interface{}{
 		"message":         "notification handled successfully",
 		"sequence_number": seqNum,
-	})
+	}, nil
 }
 
-func handleAutoNotification(client *lpa.Client) {
+func handleAutoNotification(client *lpa.Client, args []string) (interface{}, error) {
 	// Use the library's ProcessAllNotifications function
 	results, err := client.ProcessAllNotifications(&lpa.ProcessNotificationsOptions{
 		AutoRemove:      true,
 		ContinueOnError: true,
 	})
 	if err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, smdpError(err)
 	}
 
 	// Convert results to response format
@@ -914,30 +1332,38 @@ func handleAutoNotification(client *lpa.Client) {
 		}
 	}
 
-	outputSuccess(AutoNotificationResponse{
+	response := AutoNotificationResponse{
 		Message:       "auto notification processing completed",
 		Total:         len(results),
 		Processed:     len(processed),
 		Failed:        len(failed),
 		ProcessedList: processed,
 		FailedList:    failed,
-	})
+	}
+
+	// Failures go to the outbox, notification-retry sends them later
+	if len(failed) > 0 {
+		if err := queueFailedNotifications(client, failed); err != nil {
+			response.Message = fmt.Sprintf("auto notification processing completed, failed notifications not queued: %v", err)
+		} else {
+			response.Queued = len(failed)
+		}
+	}
+	return response, nil
 }
 
-func handleNotificationProcess(client *lpa.Client) {
+func handleNotificationProcess(client *lpa.Client, args []string) (interface{}, error) {
 	// Get sequence numbers from arguments
-	if flag.NArg() < 2 {
-		outputError(fmt.Errorf("sequence number(s) required"))
-		os.Exit(1)
+	if len(args) < 1 {
+		return nil, errSequenceNumberRequired
 	}
 
 	// Parse all sequence numbers from arguments
 	var sequenceNumbers []sgp22.SequenceNumber
-	for i := 1; i < flag.NArg(); i++ {
-		seqNum, err := strconv.Atoi(flag.Arg(i))
+	for _, arg := range args {
+		seqNum, err := strconv.Atoi(arg)
 		if err != nil {
-			outputError(fmt.Errorf("invalid sequence number '%s': %w", flag.Arg(i), err))
-			os.Exit(1)
+			return nil, fmt.Errorf("%w '%s': %w", errInvalidSequenceNumber, arg, err)
 		}
 		sequenceNumbers = append(sequenceNumbers, sgp22.SequenceNumber(seqNum))
 	}
@@ -951,8 +1377,7 @@ func handleNotificationProcess(client *lpa.Client) {
 		sequenceNumbers...,
 	)
 	if err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, smdpError(err)
 	}
 
 	// Convert results to response format
@@ -973,68 +1398,63 @@ func handleNotificationProcess(client *lpa.Client) {
 		}
 	}
 
-	outputSuccess(AutoNotificationResponse{
+	return AutoNotificationResponse{
 		Message:       "notification processing completed",
 		Total:         len(results),
 		Processed:     len(processed),
 		Failed:        len(failed),
 		ProcessedList: processed,
 		FailedList:    failed,
-	})
+	}, nil
 }
 
-func handleConfiguredAddresses(client *lpa.Client) {
+func handleConfiguredAddresses(client *lpa.Client, args []string) (interface{}, error) {
 	addresses, err := client.EUICCConfiguredAddresses()
 	if err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, cardError(err)
 	}
 
-	outputSuccess(ConfiguredAddressesResponse{
+	return ConfiguredAddressesResponse{
 		DefaultSMDPAddress: addresses.DefaultSMDPAddress,
 		RootSMDSAddress:    addresses.RootSMDSAddress,
-	})
+	}, nil
 }
 
-func handleSetDefaultDP(client *lpa.Client) {
-	if flag.NArg() < 2 {
-		outputError(fmt.Errorf("usage: set-default-dp <address>"))
-		os.Exit(1)
+func handleSetDefaultDP(client *lpa.Client, args []string) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("%w: set-default-dp <address>", errUsage)
 	}
 
-	address := flag.Arg(1)
+	address := args[0]
 	if err := client.SetDefaultDPAddress(address); err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, cardError(err)
 	}
 
-	outputSuccess(map[string]string{
+	return map[string]string{
 		"message": "default DP address set successfully",
 		"address": address,
-	})
+	}, nil
 }
 
-func handleChallenge(client *lpa.Client) {
+func handleChallenge(client *lpa.Client, args []string) (interface{}, error) {
 	challenge, err := client.EUICCChallenge()
 	if err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, cardError(err)
 	}
 
-	outputSuccess(map[string]string{
+	return map[string]string{
 		"challenge": hex.EncodeToString(challenge),
-	})
+	}, nil
 }
 
-func handleMemoryReset(client *lpa.Client) {
+func handleMemoryReset(client *lpa.Client, args []string) (interface{}, error) {
 	if err := client.MemoryReset(); err != nil {
-		outputError(err)
-		os.Exit(1)
+		return nil, cardError(err)
 	}
 
-	outputSuccess(map[string]string{
+	return map[string]string{
 		"message": "memory reset successfully",
-	})
+	}, nil
 }
 
 // Output helpers
@@ -1044,15 +1464,17 @@ func outputSuccess(data interface{}) {
 		Success: true,
 		Data:    data,
 	}
-	outputJSON(response)
+	outputResponse(response)
 }
 
 func outputError(err error) {
-	response := Response{
-		Success: false,
-		Error:   err.Error(),
-	}
-	outputJSON(response)
+	outputResponse(errorResponse(err))
+}
+
+// exitWithError prints the error envelope and exits with the exit code of the error category
+func exitWithError(err error) {
+	outputError(err)
+	os.Exit(classifyError("", err).exitCode())
 }
 
 func outputJSON(v interface{}) {
@@ -1072,13 +1494,28 @@ Global Options:
   -device string
         Device path (e.g., /dev/cdc-wdm0, /dev/ttyUSB2)
   -driver string
-        Driver type: qmi, mbim, at, ccid (auto-detect if not specified)
+        Driver type: qmi, mbim, at, ccid, sim, replay (auto-detect if not specified)
   -slot int
         SIM slot number (0 = use UCI config, default: UCI or 1)
   -timeout int
         HTTP timeout in seconds (0 = use UCI config, default: UCI or 30)
   -verbose
         Enable verbose logging
+  -record string
+        Record APDU exchanges to a trace file (replay with -driver replay -device <file>)
+  -trace-apdu
+        Log every APDU exchange (matching IDs and confirmation codes are masked)
+  -trace-file string
+        Write the -trace-apdu log to a file instead of stderr
+  -all-devices
+        Run the command on every discovered eUICC in parallel
+        (read-only commands and auto-notification)
+  -lock-timeout int
+        Seconds to wait for a device in use by another process (-1 = use UCI config, default: UCI or 10)
+  -output string
+        Output format: json, table, ndjson, yaml (default "json")
+  -events
+        Stream download progress as JSON lines, ending with the usual response
 
 UCI Configuration (OpenWRT):
   Settings from /etc/config/hermes-euicc are automatically loaded.
@@ -1090,30 +1527,41 @@ UCI Configuration (OpenWRT):
         option device ''            # Device path (empty = auto)
         option slot '1'             # SIM slot number
         option timeout '30'         # HTTP timeout in seconds
+        option lock_timeout '10'    # Seconds to wait for a busy device
 
 Commands:
   help                          Show this help message
   version                       Show version information
+  devices                       List modems and card readers with their EID (use --no-probe)
   eid                           Get EID
   info                          Get eUICC information (EID + EUICCInfo1 + EUICCInfo2)
   chip-info                     Get detailed chip information (parsed, includes memory/capabilities)
   list                          List all profiles
-  enable <iccid>                Enable profile by ICCID
-  disable <iccid>               Disable profile by ICCID
-  delete <iccid>                Delete profile by ICCID
-  nickname <iccid> <nickname>   Set profile nickname
-  download                      Download profile (use --code, --imei, --confirmation-code, --confirm)
+  enable <profile>              Enable profile
+  switch <profile>              Enable profile, check connectivity, roll back on failure (use --ping or --probe-script)
+  disable <profile>             Disable profile
+  delete <profile>              Delete profile
+  nickname <profile> <nickname> Set profile nickname
+  download                      Download profile (use --code or --qr, --imei, --confirmation-code[-fd], --confirm)
+  download-batch <manifest>     Download profiles listed in a JSON or CSV manifest (use --continue-on-error)
+  parse-code '<code>'           Check an activation code offline and show its fields (or use --qr)
   discovery                     Discover profiles from SM-DS (use --server, --imei)
   discover-download             Discover and download first available profile (use --server, --imei)
   notifications                 List notifications
-  notification-remove <seq>     Remove notification by sequence number
+  notification-remove <seq>     Remove notification by sequence number (or --from-file <file> after notification-send)
   notification-handle <seq>     Handle notification by sequence number
   auto-notification             Automatically process all pending notifications
+  notification-export <file>    Write signed pending notifications to a file for offline delivery
+  notification-send <file>      Deliver exported notifications to their SM-DP+ (no device needed)
+  notification-retry            Send pending notifications from the local outbox with backoff (use --status, --force)
   notification-process <seq...> Process specific notifications by sequence number(s)
   configured-addresses          Get configured SM-DP+/SM-DS addresses
   set-default-dp <address>      Set default SM-DP+ address
   challenge                     Get eUICC challenge
   memory-reset                  Reset eUICC memory
+  serve                         Run HTTP API daemon keeping the device open (use --listen)
+  ubus                          Register hermes_euicc ubus object (OpenWRT only, use --socket)
+  watchdog                      Probe connectivity and fail over between profiles (use --profiles, --ping)
 
 Examples:
   # Get EID
@@ -1124,13 +1572,33 @@ Examples:
 
   # Download profile
   %s download --code "LPA:1$smdp.io$MATCHING-ID" --confirm
+  %s download --qr operator-qr.png --confirm --nickname Travel --enable --send-notifications
+  %s download-batch --confirm --continue-on-error profiles.csv
+  %s parse-code 'LPA:1$smdp.io$MATCHING-ID'
 
-  # Enable profile
+  # Enable profile (by ICCID, its last digits, nick:, provider:, isdp: or enabled)
   %s enable 8944476500001224158
+  %s enable nick:Travel
+  %s switch 8944476500001224158 --ping 1.1.1.1
 
   # Discover profiles
   %s discovery --imei 356938035643809
 
-All commands output JSON format.
-`, os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0])
+  # Run HTTP API daemon
+  %s serve --listen 127.0.0.1:8080
+
+  # Fail over to a second operator when the first one loses connectivity
+  %s watchdog --profiles 8944476500001224158,8988247000100000017 --ping 1.1.1.1
+
+  # List profiles on every connected eUICC
+  %s -all-devices list
+
+  # Show profiles as a table
+  %s -output table list
+  %s -events download --code "LPA:1$smdp.io$MATCHING-ID" --confirm
+
+All commands output JSON unless -output is set. Errors carry a stable "code" and "category";
+the exit code reflects the category: 1 internal, 2 validation, 3 driver,
+4 transport, 5 card, 6 smdp, 7 network.
+`, os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0])
 }
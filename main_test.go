@@ -0,0 +1,23 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import "testing"
+
+func TestFinishDownloadEnable(t *testing.T) {
+	// The travel profile stands in for the one just installed
+	client, channel, path := newSimClient(t, defaultSimState())
+	dr := DownloadResponse{ICCID: simTravelICCID}
+
+	if err := finishDownload(client, &dr, postDownload{enable: true, reopen: channel.reopen}); err != nil {
+		t.Fatalf("finish download: %v", err)
+	}
+	if enabled := enabledSimProfile(t, path); enabled != simTravelICCID {
+		t.Errorf("enabled profile is %q, want %s", enabled, simTravelICCID)
+	}
+	// The profile is read back on the channel opened after the refresh
+	if dr.Profile == nil || dr.Profile.ICCID != simTravelICCID || dr.Profile.ProfileState != 1 {
+		t.Errorf("unexpected profile %+v", dr.Profile)
+	}
+}
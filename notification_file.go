@@ -0,0 +1,367 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KilimcininKorOglu/euicc-go/bertlv"
+	"github.com/KilimcininKorOglu/euicc-go/lpa"
+	sgp22 "github.com/KilimcininKorOglu/euicc-go/v2"
+)
+
+// notificationFileVersion is the format of notification-export files
+const notificationFileVersion = 1
+
+// errNoDevice is returned when notification-send, which runs without a device, would need the eUICC
+var errNoDevice = errors.New("notification-send runs without a device, the eUICC cannot be reached")
+
+// NotificationFile holds signed notifications carried from an offline device to one with internet access
+type NotificationFile struct {
+	Version       int                    `json:"version"`
+	EID           string                 `json:"eid"`
+	ExportedAt    time.Time              `json:"exported_at"`
+	Notifications []ExportedNotification `json:"notifications"`
+}
+
+// ExportedNotification is a pending notification as signed by the eUICC
+type ExportedNotification struct {
+	SequenceNumber             int    `json:"sequence_number"`
+	ProfileManagementOperation int    `json:"profile_management_operation"`
+	Operation                  string `json:"operation"`
+	Address                    string `json:"address"`
+	ICCID                      string `json:"iccid,omitempty"`
+	// PendingNotification is the base64 encoded ProfileInstallationResult or OtherSignedNotification
+	PendingNotification string     `json:"pending_notification"`
+	SentAt              *time.Time `json:"sent_at,omitempty"`
+	// RemovedAt is set by notification-remove --from-file once the notification is off the eUICC
+	RemovedAt *time.Time `json:"removed_at,omitempty"`
+}
+
+// NotificationExportResponse reports the notifications written to a file
+type NotificationExportResponse struct {
+	Message         string `json:"message"`
+	File            string `json:"file"`
+	EID             string `json:"eid"`
+	Exported        int    `json:"exported"`
+	SequenceNumbers []int  `json:"sequence_numbers"`
+}
+
+// SentNotification is the delivery result of one exported notification
+type SentNotification struct {
+	SequenceNumber int    `json:"sequence_number"`
+	Address        string `json:"address"`
+	Status         string `json:"status"` // sent, failed or already_sent
+	Error          string `json:"error,omitempty"`
+}
+
+// NotificationSendResponse reports the delivery of a notification file
+type NotificationSendResponse struct {
+	Message string             `json:"message"`
+	EID     string             `json:"eid"`
+	Total   int                `json:"total"`
+	Sent    int                `json:"sent"`
+	Failed  int                `json:"failed"`
+	Results []SentNotification `json:"results"`
+}
+
+// RemovedNotification is the removal result of one exported notification
+type RemovedNotification struct {
+	SequenceNumber int    `json:"sequence_number"`
+	Status         string `json:"status"` // removed, not_pending, not_sent or already_removed
+}
+
+// NotificationRemoveFileResponse reports the delivered notifications of a file removed from the eUICC
+type NotificationRemoveFileResponse struct {
+	Message string                `json:"message"`
+	File    string                `json:"file"`
+	EID     string                `json:"eid"`
+	Removed int                   `json:"removed"`
+	NotSent int                   `json:"not_sent"`
+	Results []RemovedNotification `json:"results"`
+}
+
+// handleNotificationExport writes the signed pending notifications to a file, all or the given sequence numbers.
+// The notifications stay on the eUICC until notification-remove --from-file removes the delivered ones.
+func handleNotificationExport(client *lpa.Client, args []string) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("%w: notification-export <file> [sequence-number...]", errUsage)
+	}
+	if !standalone {
+		return nil, fmt.Errorf("notification-export is %w, the file is written locally", errNotOverAPI)
+	}
+	path := args[0]
+
+	var pending []*sgp22.PendingNotification
+	if len(args) == 1 {
+		all, err := client.RetrieveNotificationList(nil)
+		if err != nil {
+			return nil, cardError(err)
+		}
+		pending = all
+	}
+	for _, arg := range args[1:] {
+		seqNum, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%w '%s': %w", errInvalidSequenceNumber, arg, err)
+		}
+		found, err := client.RetrieveNotificationList(sgp22.SequenceNumber(seqNum))
+		if err != nil {
+			return nil, cardError(err)
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("%w: %d", errNotificationNotFound, seqNum)
+		}
+		pending = append(pending, found[0])
+	}
+
+	eid, err := client.EID()
+	if err != nil {
+		return nil, cardError(err)
+	}
+	file := NotificationFile{
+		Version:       notificationFileVersion,
+		EID:           hex.EncodeToString(eid),
+		ExportedAt:    time.Now().UTC(),
+		Notifications: make([]ExportedNotification, 0, len(pending)),
+	}
+	response := NotificationExportResponse{
+		Message:         "notifications exported",
+		File:            path,
+		EID:             file.EID,
+		SequenceNumbers: make([]int, 0, len(pending)),
+	}
+	for _, p := range pending {
+		n := p.Notification
+		file.Notifications = append(file.Notifications, ExportedNotification{
+			SequenceNumber:             int(n.SequenceNumber),
+			ProfileManagementOperation: int(n.ProfileManagementOperation),
+			Operation:                  notificationOperation(n.ProfileManagementOperation),
+			Address:                    n.Address,
+			ICCID:                      n.ICCID.String(),
+			PendingNotification:        base64.StdEncoding.EncodeToString(p.PendingNotification.Bytes()),
+		})
+		response.SequenceNumbers = append(response.SequenceNumbers, int(n.SequenceNumber))
+	}
+	response.Exported = len(file.Notifications)
+
+	if err := writeNotificationFile(path, &file); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// handleNotificationSend delivers the notifications of an export file to their SM-DP+ without a device.
+// Delivered notifications are marked in the file, so it can be sent again after a partial failure
+// and notification-remove --from-file knows which ones to remove from the eUICC.
+func handleNotificationSend(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%w: notification-send <file>", errUsage)
+	}
+	path := args[0]
+
+	file, err := readNotificationFile(path)
+	if err != nil {
+		return nil, err
+	}
+	client, err := lpa.New(&lpa.Options{
+		Channel: detachedChannel{},
+		Timeout: time.Duration(*timeout) * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	response := NotificationSendResponse{
+		Message: "notifications sent",
+		EID:     file.EID,
+		Total:   len(file.Notifications),
+		Results: make([]SentNotification, 0, len(file.Notifications)),
+	}
+	for i := range file.Notifications {
+		n := &file.Notifications[i]
+		result := SentNotification{SequenceNumber: n.SequenceNumber, Address: n.Address, Status: "already_sent"}
+		if n.SentAt == nil {
+			if err := sendNotification(client, n); err != nil {
+				result.Status, result.Error = "failed", err.Error()
+				response.Failed++
+			} else {
+				now := time.Now().UTC()
+				n.SentAt = &now
+				result.Status = "sent"
+				response.Sent++
+			}
+		}
+		response.Results = append(response.Results, result)
+	}
+	if response.Failed > 0 {
+		response.Message = "some notifications were not sent, run notification-send again later"
+	}
+
+	if err := writeNotificationFile(path, file); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// removeSentNotifications removes the notifications of a file that notification-send delivered from the eUICC,
+// so auto-notification and notification-retry do not send them a second time. Notifications not sent yet stay.
+func removeSentNotifications(client *lpa.Client, path string) (interface{}, error) {
+	file, err := readNotificationFile(path)
+	if err != nil {
+		return nil, err
+	}
+	eidBytes, err := client.EID()
+	if err != nil {
+		return nil, cardError(err)
+	}
+	if eid := hex.EncodeToString(eidBytes); !strings.EqualFold(file.EID, eid) {
+		return nil, fmt.Errorf("%w: exported from eUICC %s, not %s", errInvalidNotificationFile, file.EID, eid)
+	}
+
+	notifications, err := client.ListNotification()
+	if err != nil {
+		return nil, cardError(err)
+	}
+	pending := make(map[int]*sgp22.NotificationMetadata, len(notifications))
+	for _, n := range notifications {
+		pending[int(n.SequenceNumber)] = n
+	}
+
+	response := NotificationRemoveFileResponse{
+		Message: "delivered notifications removed",
+		File:    path,
+		EID:     file.EID,
+		Results: make([]RemovedNotification, 0, len(file.Notifications)),
+	}
+	for i := range file.Notifications {
+		n := &file.Notifications[i]
+		result := RemovedNotification{SequenceNumber: n.SequenceNumber, Status: "already_removed"}
+		p, ok := pending[n.SequenceNumber]
+		switch {
+		case n.RemovedAt != nil:
+		case n.SentAt == nil:
+			result.Status = "not_sent"
+			response.NotSent++
+		case !ok || p.ICCID.String() != n.ICCID || int(p.ProfileManagementOperation) != n.ProfileManagementOperation:
+			// Gone since the export, e.g. sent by notification-retry or removed by hand
+			now := time.Now().UTC()
+			n.RemovedAt = &now
+			result.Status = "not_pending"
+		default:
+			if err := client.RemoveNotificationFromList(sgp22.SequenceNumber(n.SequenceNumber)); err != nil {
+				// Keep the marks of the notifications removed so far
+				if writeErr := writeNotificationFile(path, file); writeErr != nil {
+					log.Printf("Failed to update %s: %v\n", path, writeErr)
+				}
+				return nil, fmt.Errorf("failed to remove notification %d: %w", n.SequenceNumber, cardError(err))
+			}
+			now := time.Now().UTC()
+			n.RemovedAt = &now
+			result.Status = "removed"
+			response.Removed++
+		}
+		response.Results = append(response.Results, result)
+	}
+	if response.NotSent > 0 {
+		response.Message = "delivered notifications removed, the rest stay on the eUICC until notification-send delivers them"
+	}
+
+	if err := writeNotificationFile(path, file); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// detachedChannel stands in for a device so notification-send can use the library's ES9+ client.
+// Delivering a signed notification needs no eUICC; any command sent to one fails.
+type detachedChannel struct{}
+
+func (detachedChannel) Connect() error                              { return nil }
+func (detachedChannel) Disconnect() error                           { return nil }
+func (detachedChannel) OpenLogicalChannel(aid []byte) (byte, error) { return 1, nil }
+func (detachedChannel) CloseLogicalChannel(channel byte) error      { return nil }
+func (detachedChannel) Transmit(command []byte) ([]byte, error)     { return nil, errNoDevice }
+
+// sendNotification delivers one exported notification with the library's ES9+ HandleNotification (SGP.22 5.6.4)
+func sendNotification(client *lpa.Client, n *ExportedNotification) error {
+	if n.Address == "" {
+		return errors.New("notification has no SM-DP+ address")
+	}
+	if err := validateSMDPAddress(n.Address); err != nil {
+		return fmt.Errorf("invalid SM-DP+ address %q: %w", n.Address, err)
+	}
+	pending, err := pendingNotification(n)
+	if err != nil {
+		return err
+	}
+	return smdpError(client.HandleNotification(pending))
+}
+
+// pendingNotification rebuilds the library's pending notification from its exported form
+func pendingNotification(n *ExportedNotification) (*sgp22.PendingNotification, error) {
+	data, err := base64.StdEncoding.DecodeString(n.PendingNotification)
+	if err != nil {
+		return nil, fmt.Errorf("%w: notification %d: %w", errInvalidNotificationFile, n.SequenceNumber, err)
+	}
+	signed := new(bertlv.TLV)
+	if err := signed.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("%w: notification %d: %w", errInvalidNotificationFile, n.SequenceNumber, err)
+	}
+
+	metadata := &sgp22.NotificationMetadata{
+		SequenceNumber:             sgp22.SequenceNumber(n.SequenceNumber),
+		ProfileManagementOperation: sgp22.NotificationEvent(n.ProfileManagementOperation),
+		Address:                    n.Address,
+	}
+	if n.ICCID != "" {
+		if metadata.ICCID, err = sgp22.NewICCID(n.ICCID); err != nil {
+			return nil, fmt.Errorf("%w: notification %d: %w", errInvalidNotificationFile, n.SequenceNumber, err)
+		}
+	}
+	return &sgp22.PendingNotification{Notification: metadata, PendingNotification: signed}, nil
+}
+
+// readNotificationFile reads and checks a notification-export file
+func readNotificationFile(path string) (*NotificationFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidNotificationFile, err)
+	}
+	file := &NotificationFile{}
+	if err := json.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidNotificationFile, err)
+	}
+	if file.Version != notificationFileVersion {
+		return nil, fmt.Errorf("%w: version %d is not supported", errInvalidNotificationFile, file.Version)
+	}
+	for _, n := range file.Notifications {
+		if _, err := base64.StdEncoding.DecodeString(n.PendingNotification); err != nil {
+			return nil, fmt.Errorf("%w: notification %d: %w", errInvalidNotificationFile, n.SequenceNumber, err)
+		}
+	}
+	return file, nil
+}
+
+// writeNotificationFile writes a notification file readable only by its owner
+func writeNotificationFile(path string, file *NotificationFile) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("%w: %w", errInvalidNotificationFile, err)
+	}
+	return nil
+}
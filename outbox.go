@@ -0,0 +1,333 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/KilimcininKorOglu/euicc-go/lpa"
+	sgp22 "github.com/KilimcininKorOglu/euicc-go/v2"
+)
+
+// OutboxEntry is a pending notification and its delivery attempts
+type OutboxEntry struct {
+	EID                        string     `json:"eid"`
+	SequenceNumber             int        `json:"sequence_number"`
+	ProfileManagementOperation int        `json:"profile_management_operation"`
+	Operation                  string     `json:"operation"`
+	Address                    string     `json:"address,omitempty"`
+	ICCID                      string     `json:"iccid,omitempty"`
+	FirstSeen                  time.Time  `json:"first_seen"`
+	Attempts                   int        `json:"attempts"`
+	LastAttempt                *time.Time `json:"last_attempt,omitempty"`
+	LastError                  string     `json:"last_error,omitempty"`
+	NextRetry                  time.Time  `json:"next_retry"`
+	// Acknowledged is set when the SM-DP+ accepted the notification but removing it from the card failed
+	Acknowledged bool `json:"acknowledged,omitempty"`
+}
+
+// outboxPath is the outbox file: the outbox config option, or defaultOutboxPath
+var outboxPath = defaultOutboxPath()
+
+// outboxMu serialises outbox updates of the devices of a -all-devices run,
+// lockOutbox also keeps other processes out
+var outboxMu sync.Mutex
+
+// defaultOutboxBackoff is the retry schedule of notification-retry, also used for failed sends of other commands
+var defaultOutboxBackoff = outboxBackoff{base: time.Minute, max: 6 * time.Hour}
+
+// outbox is the local record of pending notifications, kept in a JSON file
+type outbox struct {
+	path    string
+	Entries []OutboxEntry `json:"entries"`
+}
+
+// NotificationRetryResponse reports one pass over the outbox
+type NotificationRetryResponse struct {
+	Message  string                  `json:"message"`
+	Sent     []ProcessedNotification `json:"sent"`
+	Failed   []FailedNotification    `json:"failed"`
+	Deferred int                     `json:"deferred"`
+	Outbox   []OutboxEntry           `json:"outbox"`
+}
+
+// outboxBackoff sets the delay before the next attempt: base, doubled per failed attempt, up to max
+type outboxBackoff struct {
+	base time.Duration
+	max  time.Duration
+}
+
+// delay returns the wait after the given number of failed attempts
+func (b outboxBackoff) delay(attempts int) time.Duration {
+	d := b.base
+	for i := 1; i < attempts && d < b.max; i++ {
+		d *= 2
+	}
+	return min(d, b.max)
+}
+
+func handleNotificationRetry(client *lpa.Client, args []string) (interface{}, error) {
+	retryFlags := flag.NewFlagSet("notification-retry", flag.ContinueOnError)
+	path := retryFlags.String("outbox", outboxPath, "Outbox file")
+	base := retryFlags.Duration("base-delay", defaultOutboxBackoff.base, "Delay after the first failed attempt")
+	maxDelay := retryFlags.Duration("max-delay", defaultOutboxBackoff.max, "Longest delay between attempts")
+	force := retryFlags.Bool("force", false, "Send every notification now, ignoring its next retry time")
+	status := retryFlags.Bool("status", false, "Record pending notifications and show the outbox without sending")
+	if err := retryFlags.Parse(args); err != nil {
+		return nil, markError(errInvalidFlag, err)
+	}
+	if *base <= 0 || *maxDelay < *base {
+		return nil, fmt.Errorf("%w %s for flag -base-delay: must be positive and at most -max-delay", errInvalidFlagValue, *base)
+	}
+	if *path != outboxPath && !standalone {
+		return nil, fmt.Errorf("%w -outbox: not available over the API", errInvalidFlag)
+	}
+
+	eidBytes, err := client.EID()
+	if err != nil {
+		return nil, cardError(err)
+	}
+	eid := hex.EncodeToString(eidBytes)
+
+	unlock, err := lockOutbox(*path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	box, err := loadOutbox(*path)
+	if err != nil {
+		return nil, err
+	}
+	if err := box.sync(client, eid, time.Now()); err != nil {
+		return nil, err
+	}
+
+	response := NotificationRetryResponse{
+		Message: "notification retry completed",
+		Sent:    make([]ProcessedNotification, 0),
+		Failed:  make([]FailedNotification, 0),
+	}
+	if !*status {
+		box.retry(client, eid, outboxBackoff{base: *base, max: *maxDelay}, *force, &response)
+	} else {
+		response.Message = "outbox updated, nothing sent"
+	}
+
+	if err := box.save(); err != nil {
+		return nil, err
+	}
+	response.Outbox = box.forEID(eid)
+	return response, nil
+}
+
+// sync adds the notifications pending on the card to the outbox and drops entries no longer on it
+func (b *outbox) sync(client *lpa.Client, eid string, now time.Time) error {
+	notifications, err := client.ListNotification()
+	if err != nil {
+		return cardError(err)
+	}
+
+	pending := make(map[int]*sgp22.NotificationMetadata, len(notifications))
+	for _, n := range notifications {
+		pending[int(n.SequenceNumber)] = n
+	}
+
+	entries := b.Entries[:0]
+	for _, e := range b.Entries {
+		if e.EID == eid {
+			n, ok := pending[e.SequenceNumber]
+			// Gone from the card: sent by another command or removed by hand
+			if !ok || n.ICCID.String() != e.ICCID || int(n.ProfileManagementOperation) != e.ProfileManagementOperation {
+				if *verbose {
+					log.Printf("Notification %d no longer pending, dropped from outbox\n", e.SequenceNumber)
+				}
+				continue
+			}
+			delete(pending, e.SequenceNumber)
+		}
+		entries = append(entries, e)
+	}
+
+	for _, n := range notifications {
+		if _, ok := pending[int(n.SequenceNumber)]; !ok {
+			continue
+		}
+		entries = append(entries, OutboxEntry{
+			EID:                        eid,
+			SequenceNumber:             int(n.SequenceNumber),
+			ProfileManagementOperation: int(n.ProfileManagementOperation),
+			Operation:                  notificationOperation(n.ProfileManagementOperation),
+			Address:                    n.Address,
+			ICCID:                      n.ICCID.String(),
+			FirstSeen:                  now,
+			NextRetry:                  now,
+		})
+	}
+	b.Entries = entries
+	return nil
+}
+
+// retry sends the due notifications of a card and removes them from the card once the SM-DP+ accepted them
+func (b *outbox) retry(client *lpa.Client, eid string, backoff outboxBackoff, force bool, response *NotificationRetryResponse) {
+	entries := b.Entries[:0]
+	for _, e := range b.Entries {
+		now := time.Now()
+		if e.EID != eid || (!force && now.Before(e.NextRetry)) {
+			if e.EID == eid {
+				response.Deferred++
+			}
+			entries = append(entries, e)
+			continue
+		}
+
+		err := sendOutboxEntry(client, &e)
+		if err == nil {
+			response.Sent = append(response.Sent, ProcessedNotification{SequenceNumber: e.SequenceNumber, Removed: true})
+			continue
+		}
+
+		e.Attempts++
+		e.LastAttempt = &now
+		e.LastError = err.Error()
+		e.NextRetry = now.Add(backoff.delay(e.Attempts))
+		response.Failed = append(response.Failed, FailedNotification{SequenceNumber: e.SequenceNumber, Error: e.LastError})
+		entries = append(entries, e)
+	}
+	b.Entries = entries
+}
+
+// queueFailedNotifications records notifications another command failed to send in the outbox.
+// The failure counts as an attempt, so notification-retry resends them with backoff.
+func queueFailedNotifications(client *lpa.Client, failed []FailedNotification) error {
+	eidBytes, err := client.EID()
+	if err != nil {
+		return cardError(err)
+	}
+	eid := hex.EncodeToString(eidBytes)
+
+	unlock, err := lockOutbox(outboxPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	box, err := loadOutbox(outboxPath)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := box.sync(client, eid, now); err != nil {
+		return err
+	}
+	for i := range box.Entries {
+		e := &box.Entries[i]
+		for _, f := range failed {
+			if e.EID == eid && e.SequenceNumber == f.SequenceNumber {
+				e.Attempts++
+				e.LastAttempt = &now
+				e.LastError = f.Error
+				e.NextRetry = now.Add(defaultOutboxBackoff.delay(e.Attempts))
+			}
+		}
+	}
+	return box.save()
+}
+
+// sendOutboxEntry hands one notification to its SM-DP+ and then removes it from the card
+func sendOutboxEntry(client *lpa.Client, e *OutboxEntry) error {
+	seq := sgp22.SequenceNumber(e.SequenceNumber)
+	if !e.Acknowledged {
+		notifications, err := client.RetrieveNotificationList(seq)
+		if err != nil {
+			return cardError(err)
+		}
+		if len(notifications) == 0 {
+			return errNotificationNotFound
+		}
+		if err := client.HandleNotification(notifications[0]); err != nil {
+			return smdpError(err)
+		}
+		e.Acknowledged = true
+	}
+	if err := client.RemoveNotificationFromList(seq); err != nil {
+		return fmt.Errorf("sent, but not removed from the card: %w", cardError(err))
+	}
+	return nil
+}
+
+// forEID returns the outbox entries of one card
+func (b *outbox) forEID(eid string) []OutboxEntry {
+	entries := make([]OutboxEntry, 0)
+	for _, e := range b.Entries {
+		if e.EID == eid {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// lockOutbox locks the outbox file at path for a load, change and save, against other
+// processes through a flock on <path>.lock. The returned function unlocks it.
+func lockOutbox(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to lock outbox: %w", err)
+	}
+	outboxMu.Lock()
+	lock, err := lockFile(path+".lock", path, time.Duration(*lockTimeout)*time.Second)
+	if err != nil {
+		outboxMu.Unlock()
+		return nil, fmt.Errorf("failed to lock outbox: %w", err)
+	}
+	return func() {
+		lock.release()
+		outboxMu.Unlock()
+	}, nil
+}
+
+// loadOutbox reads the outbox file; a missing file is an empty outbox
+func loadOutbox(path string) (*outbox, error) {
+	b := &outbox{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %w", err)
+	}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("%w %s: %w", errInvalidOutbox, path, err)
+	}
+	return b, nil
+}
+
+// save writes the outbox file atomically. An unchanged outbox is not written again, sparing flash.
+func (b *outbox) save() error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	if current, err := os.ReadFile(b.path); err == nil && bytes.Equal(current, data) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(b.path), 0700); err != nil {
+		return fmt.Errorf("failed to write outbox: %w", err)
+	}
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write outbox: %w", err)
+	}
+	if err := os.Rename(tmp, b.path); err != nil {
+		return fmt.Errorf("failed to write outbox: %w", err)
+	}
+	return nil
+}
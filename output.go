@@ -0,0 +1,413 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+)
+
+// outputFormats lists the values accepted by -output
+var outputFormats = map[string]bool{"json": true, "table": true, "ndjson": true, "yaml": true}
+
+// outputResponse writes a response envelope in the format selected with -output
+func outputResponse(response Response) {
+	var err error
+	switch *outputFormat {
+	case "table":
+		err = writeTable(os.Stdout, response)
+	case "ndjson":
+		err = writeNDJSON(os.Stdout, response)
+	case "yaml":
+		err = writeYAML(os.Stdout, response)
+	default:
+		if downloadEvents != nil {
+			// The last line of an -events stream
+			err = json.NewEncoder(os.Stdout).Encode(response)
+			break
+		}
+		outputJSON(response)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// writeNDJSON writes each element of list data as one compact JSON line, other data and errors as one line
+func writeNDJSON(w io.Writer, response Response) error {
+	encoder := json.NewEncoder(w)
+	if !response.Success {
+		return encoder.Encode(response)
+	}
+
+	value, err := orderedJSON(response.Data)
+	if err != nil {
+		return err
+	}
+	if list, ok := value.([]interface{}); ok {
+		for _, item := range list {
+			if err := encoder.Encode(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return encoder.Encode(value)
+}
+
+// jsonField is one member of a JSON object, kept in document order
+type jsonField struct {
+	key   string
+	value interface{}
+}
+
+// jsonObject is a JSON object that keeps the field order of the struct it was encoded from
+type jsonObject []jsonField
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.key)
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// orderedJSON converts v to its JSON form (jsonObject, []interface{}, string, json.Number, bool or nil)
+func orderedJSON(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decodeOrdered(decoder)
+}
+
+func decodeOrdered(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		object := jsonObject{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, jsonField{key: key.(string), value: value})
+		}
+		_, err = decoder.Token() // closing brace
+		return object, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for decoder.More() {
+			value, err := decodeOrdered(decoder)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err = decoder.Token() // closing bracket
+		return list, err
+	default:
+		return token, nil
+	}
+}
+
+// writeYAML writes the response envelope as a YAML document
+func writeYAML(w io.Writer, response Response) error {
+	value, err := orderedJSON(response)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	writeYAMLValue(&buf, value, 0)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func writeYAMLValue(buf *bytes.Buffer, value interface{}, indent int) {
+	pad := strings.Repeat("  ", indent)
+	switch v := value.(type) {
+	case jsonObject:
+		for _, field := range v {
+			buf.WriteString(pad + yamlString(field.key) + ":")
+			writeYAMLChild(buf, field.value, indent+1)
+		}
+	case []interface{}:
+		for _, item := range v {
+			buf.WriteString(pad + "-")
+			if object, ok := item.(jsonObject); ok && len(object) > 0 {
+				// First field on the dash line, the rest aligned below it
+				var nested bytes.Buffer
+				writeYAMLValue(&nested, object, indent+1)
+				buf.WriteString(" " + strings.TrimPrefix(nested.String(), strings.Repeat("  ", indent+1)))
+				continue
+			}
+			writeYAMLChild(buf, item, indent+1)
+		}
+	default:
+		buf.WriteString(pad + yamlScalar(v) + "\n")
+	}
+}
+
+// writeYAMLChild writes a value after "key:" or "-", inline if it is a scalar or empty
+func writeYAMLChild(buf *bytes.Buffer, value interface{}, indent int) {
+	switch v := value.(type) {
+	case jsonObject:
+		if len(v) == 0 {
+			buf.WriteString(" {}\n")
+			return
+		}
+		buf.WriteString("\n")
+		writeYAMLValue(buf, v, indent)
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteString(" []\n")
+			return
+		}
+		buf.WriteString("\n")
+		writeYAMLValue(buf, v, indent)
+	default:
+		buf.WriteString(" " + yamlScalar(v) + "\n")
+	}
+}
+
+func yamlScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return fmt.Sprint(v)
+	case json.Number:
+		return v.String()
+	case string:
+		return yamlString(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// yamlPlain matches strings that can be written unquoted without changing their type
+var yamlPlain = regexp.MustCompile(`^[A-Za-z0-9_./+(][A-Za-z0-9_./+@() ,-]*$`)
+
+// yamlReserved are plain scalars YAML would read as something other than a string
+var yamlReserved = regexp.MustCompile(`(?i)^(true|false|yes|no|on|off|y|n|null|~|[-+]?(\d[\d_]*)?\.?\d+([eE][-+]?\d+)?|0x[0-9a-f]+|0o[0-7]+|[-+]?\.(inf|nan)|\d{4}-\d\d?-\d\d?.*)$`)
+
+// yamlString quotes a string when needed; JSON string syntax is valid YAML
+func yamlString(s string) string {
+	if yamlPlain.MatchString(s) && !yamlReserved.MatchString(s) && !strings.HasSuffix(s, " ") {
+		return s
+	}
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
+
+// writeTable renders a response for reading in a terminal
+func writeTable(w io.Writer, response Response) error {
+	if !response.Success {
+		fmt.Fprintf(w, "Error: %s\n", response.Error)
+		if response.Code != "" {
+			fmt.Fprintf(w, "Code:  %s (%s)\n", response.Code, response.Category)
+		}
+		return nil
+	}
+
+	// Commands with a dedicated layout
+	if profiles, ok := response.Data.([]ProfileResponse); ok {
+		return writeProfileTable(w, profiles)
+	}
+
+	value, err := orderedJSON(response.Data)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	writeTableValue(&buf, value, "")
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// writeProfileTable renders the profile list as aligned columns
+func writeProfileTable(w io.Writer, profiles []ProfileResponse) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ICCID\tSTATE\tNICKNAME\tPROVIDER\tCLASS")
+	for _, p := range profiles {
+		state := "disabled"
+		if p.ProfileState == 1 {
+			state = "enabled"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			p.ICCID, state, tableCell(p.ProfileNickname), tableCell(p.ServiceProviderName), tableCell(p.ProfileClass))
+	}
+	return tw.Flush()
+}
+
+// writeTableValue renders objects as aligned "Name: value" lines with nested objects as indented sections,
+// and lists of objects as column tables
+func writeTableValue(buf *bytes.Buffer, value interface{}, indent string) {
+	switch v := value.(type) {
+	case jsonObject:
+		// Scalars first so they align, then one section per nested value
+		tw := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+		for _, field := range v {
+			if isTableScalar(field.value) {
+				fmt.Fprintf(tw, "%s%s:\t%s\n", indent, humanizeKey(field.key), tableCell(field.value))
+			}
+		}
+		tw.Flush()
+		for _, field := range v {
+			if !isTableScalar(field.value) {
+				fmt.Fprintf(buf, "\n%s%s\n", indent, humanizeKey(field.key))
+				writeTableValue(buf, field.value, indent+"  ")
+			}
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			fmt.Fprintf(buf, "%s(none)\n", indent)
+			return
+		}
+		if _, ok := v[0].(jsonObject); ok {
+			writeColumns(buf, v, indent)
+			return
+		}
+		for _, item := range v {
+			fmt.Fprintf(buf, "%s%s\n", indent, tableCell(item))
+		}
+	default:
+		fmt.Fprintf(buf, "%s%s\n", indent, tableCell(v))
+	}
+}
+
+// writeColumns renders a list of objects with one column per field
+func writeColumns(buf *bytes.Buffer, rows []interface{}, indent string) {
+	var columns []string
+	seen := map[string]bool{}
+	for _, row := range rows {
+		if object, ok := row.(jsonObject); ok {
+			for _, field := range object {
+				if !seen[field.key] {
+					seen[field.key] = true
+					columns = append(columns, field.key)
+				}
+			}
+		}
+	}
+
+	tw := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = strings.ToUpper(humanizeKey(column))
+	}
+	fmt.Fprintf(tw, "%s%s\n", indent, strings.Join(header, "\t"))
+	for _, row := range rows {
+		object, _ := row.(jsonObject)
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			cells[i] = "-"
+			for _, field := range object {
+				if field.key == column {
+					cells[i] = tableCell(field.value)
+				}
+			}
+		}
+		fmt.Fprintf(tw, "%s%s\n", indent, strings.Join(cells, "\t"))
+	}
+	tw.Flush()
+}
+
+func isTableScalar(value interface{}) bool {
+	switch v := value.(type) {
+	case jsonObject:
+		return false
+	case []interface{}:
+		// Short lists of plain values fit on one line
+		for _, item := range v {
+			if !isTableScalar(item) {
+				return false
+			}
+		}
+		return true
+	default:
+		return true
+	}
+}
+
+// tableCell formats a value for a single table cell
+func tableCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "-"
+	case string:
+		if v == "" {
+			return "-"
+		}
+		return v
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = tableCell(item)
+		}
+		if len(parts) == 0 {
+			return "-"
+		}
+		return strings.Join(parts, ", ")
+	case jsonObject:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// keyWords spells out abbreviations in JSON keys
+var keyWords = map[string]string{
+	"eid": "EID", "iccid": "ICCID", "isdp": "ISD-P", "aid": "AID", "euicc": "eUICC", "euicc_info1": "eUICC Info 1",
+	"euicc_info2": "eUICC Info 2", "smdp": "SM-DP+", "smds": "SM-DS", "svn": "SVN", "pp": "PP", "ppr": "PPR",
+	"ids": "IDs", "plmn": "PLMN", "gid1": "GID1", "gid2": "GID2", "ts102241": "TS 102 241", "uicc": "UICC",
+	"rsp": "RSP", "ci": "CI", "pki": "PKI", "url": "URL", "usb": "USB", "id": "ID", "isdr": "ISD-R", "imei": "IMEI",
+}
+
+// humanizeKey turns a JSON key such as default_smdp_address into "Default SM-DP+ Address"
+func humanizeKey(key string) string {
+	if word, ok := keyWords[key]; ok {
+		return word
+	}
+	words := strings.Split(key, "_")
+	for i, word := range words {
+		if spelled, ok := keyWords[word]; ok {
+			words[i] = spelled
+		} else if word != "" {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// confirmationCodeEnv is read for the confirmation code when no option provides one
+const confirmationCodeEnv = "HERMES_CONFIRMATION_CODE"
+
+// standalone is set when a single command runs from the command line.
+// Options and variables that read local secrets are refused over the serve and ubus APIs.
+var standalone bool
+
+// interactive is set when a single command runs from a terminal.
+// Daemons and -all-devices never prompt.
+var interactive bool
+
+// stdinIsTerminal reports whether standard input is a terminal
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmDownload shows the offered profile on stderr and asks whether to install it
+func confirmDownload(m *ProfileMetadataResponse) bool {
+	fmt.Fprintln(os.Stderr, "The SM-DP+ offers this profile:")
+	fields := []struct{ name, value string }{
+		{"Provider", m.ServiceProviderName},
+		{"Profile name", m.ProfileName},
+		{"Class", m.ProfileClass},
+		{"ICCID", m.ICCID},
+		{"Icon", m.IconFileType},
+		{"Policy rules", strings.Join(m.ProfilePolicyRules, ", ")},
+	}
+	for _, f := range fields {
+		if f.value == "" {
+			f.value = "-"
+		}
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", f.name+":", f.value)
+	}
+	return promptYesNo("Download and install this profile?")
+}
+
+// promptYesNo asks a question on stderr; anything but y or yes is a no
+func promptYesNo(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", question)
+	answer, err := readLine(os.Stdin)
+	if err != nil && answer == "" {
+		fmt.Fprintln(os.Stderr)
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// promptConfirmationCode asks for the confirmation code on the terminal without echoing it
+func promptConfirmationCode() string {
+	fmt.Fprint(os.Stderr, "Confirmation code: ")
+	code, err := readSecretLine(os.Stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read confirmation code: %v\n", err)
+		return ""
+	}
+	return strings.TrimSpace(code)
+}
+
+// resolveConfirmationCode picks the confirmation code from --confirmation-code, --confirmation-code-fd
+// or the environment, in that order. An empty code is asked for on the terminal if the SM-DP+ requires one.
+func resolveConfirmationCode(code string, fd int) (string, error) {
+	if code != "" {
+		return code, nil
+	}
+	if fd >= 0 {
+		if !standalone {
+			return "", fmt.Errorf("%w -confirmation-code-fd: not available over the API", errInvalidFlag)
+		}
+		return readConfirmationCodeFD(fd)
+	}
+	if standalone {
+		return os.Getenv(confirmationCodeEnv), nil
+	}
+	return "", nil
+}
+
+// readConfirmationCodeFD reads the confirmation code from an inherited file descriptor, e.g. 3<code.txt
+func readConfirmationCodeFD(fd int) (string, error) {
+	file := os.NewFile(uintptr(fd), "confirmation-code")
+	if file == nil {
+		return "", fmt.Errorf("%w %d for flag -confirmation-code-fd", errInvalidFlagValue, fd)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, 256))
+	if err != nil {
+		return "", fmt.Errorf("failed to read confirmation code from fd %d: %w", fd, err)
+	}
+	code := strings.TrimSpace(string(data))
+	if code == "" {
+		return "", fmt.Errorf("%w %d for flag -confirmation-code-fd: no code read", errInvalidFlagValue, fd)
+	}
+	return code, nil
+}
+
+// readLine reads up to a newline one byte at a time, so no input after it is consumed
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				return string(line), nil
+			}
+			line = append(line, buf[0])
+		}
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				return string(line), nil
+			}
+			return string(line), err
+		}
+	}
+}
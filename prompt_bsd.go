@@ -0,0 +1,14 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// Terminal attribute ioctls used by readSecretLine
+const (
+	ioctlGetTermios = unix.TIOCGETA
+	ioctlSetTermios = unix.TIOCSETA
+)
@@ -0,0 +1,14 @@
+//go:build linux
+
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// Terminal attribute ioctls used by readSecretLine
+const (
+	ioctlGetTermios = unix.TCGETS
+	ioctlSetTermios = unix.TCSETS
+)
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly && !windows
+
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// readSecretLine is not available without terminal control
+func readSecretLine(f *os.File) (string, error) {
+	return "", errors.New("masked input is not supported on this platform")
+}
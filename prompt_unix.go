@@ -0,0 +1,51 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// readSecretLine reads a line from a terminal with echo turned off
+func readSecretLine(f *os.File) (string, error) {
+	fd := int(f.Fd())
+	state, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return "", err
+	}
+
+	masked := *state
+	masked.Lflag &^= unix.ECHO
+	masked.Lflag |= unix.ICANON | unix.ISIG
+	masked.Iflag |= unix.ICRNL
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, &masked); err != nil {
+		return "", err
+	}
+
+	// Turn echo back on even if the prompt is interrupted
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	defer func() {
+		signal.Stop(signals)
+		close(done)
+		unix.IoctlSetTermios(fd, ioctlSetTermios, state)
+	}()
+	go func() {
+		select {
+		case <-signals:
+			unix.IoctlSetTermios(fd, ioctlSetTermios, state)
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+
+	return readLine(f)
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// readSecretLine reads a line from the console with echo turned off
+func readSecretLine(f *os.File) (string, error) {
+	handle := windows.Handle(f.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return "", err
+	}
+
+	masked := mode&^windows.ENABLE_ECHO_INPUT | windows.ENABLE_PROCESSED_INPUT | windows.ENABLE_LINE_INPUT
+	if err := windows.SetConsoleMode(handle, masked); err != nil {
+		return "", err
+	}
+	defer windows.SetConsoleMode(handle, mode)
+
+	line, err := readLine(f)
+	return strings.TrimSuffix(line, "\r"), err
+}
@@ -0,0 +1,474 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"sort"
+)
+
+// qrMaxImageSize is the largest image side scanned at full resolution, larger images are scaled down
+const qrMaxImageSize = 1600
+
+// qrMaxAttempts limits how many finder pattern combinations are tried in a cluttered image
+const qrMaxAttempts = 20
+
+// errNoQRCode is returned when an image contains nothing that looks like a QR code
+var errNoQRCode = errors.New("no QR code found in image")
+
+// decodeQRFile reads a PNG or JPEG image and returns the text of the QR code in it
+func decodeQRFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errInvalidQRImage, err)
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return "", fmt.Errorf("%w %s: %w", errInvalidQRImage, path, err)
+	}
+	text, err := decodeQRImage(img)
+	if err != nil {
+		return "", fmt.Errorf("%w %s: %w", errInvalidQRImage, path, err)
+	}
+	return text, nil
+}
+
+// decodeQRImage finds and decodes a QR code, dark on light or light on dark
+func decodeQRImage(img image.Image) (string, error) {
+	luma := newQRLuma(img)
+	err := errNoQRCode
+	for _, inverted := range []bool{false, true} {
+		text, decodeErr := luma.binarize(inverted).decode()
+		if decodeErr == nil {
+			return text, nil
+		}
+		// Keep the most specific reason, a symbol that was found but not read
+		if !errors.Is(decodeErr, errNoQRCode) {
+			err = decodeErr
+		}
+	}
+	return "", err
+}
+
+// qrLuma is a grayscale copy of an image, scaled down if it is large
+type qrLuma struct {
+	w, h int
+	pix  []uint8
+}
+
+func newQRLuma(img image.Image) *qrLuma {
+	bounds := img.Bounds()
+	scale := 1
+	for max(bounds.Dx(), bounds.Dy())/scale > qrMaxImageSize {
+		scale++
+	}
+
+	l := &qrLuma{w: bounds.Dx() / scale, h: bounds.Dy() / scale}
+	l.pix = make([]uint8, l.w*l.h)
+	for y := 0; y < l.h; y++ {
+		for x := 0; x < l.w; x++ {
+			var sum uint32
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					r, g, b, a := img.At(bounds.Min.X+x*scale+dx, bounds.Min.Y+y*scale+dy).RGBA()
+					// Transparent pixels are shown on white
+					white := 0xffff - a
+					sum += ((299*(r+white) + 587*(g+white) + 114*(b+white)) / 1000) >> 8
+				}
+			}
+			l.pix[y*l.w+x] = uint8(sum / uint32(scale*scale))
+		}
+	}
+	return l
+}
+
+// binarize marks pixels that are darker than their surroundings, so uneven lighting in photos
+// does not matter. The local threshold stays near the global one for areas of a single colour.
+func (l *qrLuma) binarize(inverted bool) *qrBits {
+	global := l.otsuThreshold()
+
+	// Integral image for the mean brightness around each pixel
+	stride := l.w + 1
+	integral := make([]uint32, stride*(l.h+1))
+	for y := 0; y < l.h; y++ {
+		var row uint32
+		for x := 0; x < l.w; x++ {
+			row += uint32(l.pix[y*l.w+x])
+			integral[(y+1)*stride+x+1] = integral[y*stride+x+1] + row
+		}
+	}
+
+	radius := max(8, min(l.w, l.h)/16)
+	bits := &qrBits{w: l.w, h: l.h, dark: make([]bool, l.w*l.h)}
+	for y := 0; y < l.h; y++ {
+		y0, y1 := max(0, y-radius), min(l.h, y+radius+1)
+		for x := 0; x < l.w; x++ {
+			x0, x1 := max(0, x-radius), min(l.w, x+radius+1)
+			sum := integral[y1*stride+x1] - integral[y0*stride+x1] - integral[y1*stride+x0] + integral[y0*stride+x0]
+			mean := float64(sum) / float64((y1-y0)*(x1-x0))
+
+			threshold := math.Min(math.Max(mean*0.93, global*0.5), global*1.5)
+			bits.dark[y*l.w+x] = (float64(l.pix[y*l.w+x]) < threshold) != inverted
+		}
+	}
+	return bits
+}
+
+// otsuThreshold returns the brightness that best separates dark and light pixels
+func (l *qrLuma) otsuThreshold() float64 {
+	var histogram [256]int
+	var total float64
+	for _, p := range l.pix {
+		histogram[p]++
+		total += float64(p)
+	}
+
+	n := float64(len(l.pix))
+	var best, threshold, weight, sum float64
+	for t := 0; t < 256; t++ {
+		weight += float64(histogram[t])
+		if weight == 0 || weight == n {
+			continue
+		}
+		sum += float64(t * histogram[t])
+		meanDark := sum / weight
+		meanLight := (total - sum) / (n - weight)
+		between := weight * (n - weight) * (meanDark - meanLight) * (meanDark - meanLight)
+		if between > best {
+			best, threshold = between, float64(t)+0.5
+		}
+	}
+	if best == 0 {
+		return 128
+	}
+	return threshold
+}
+
+// qrBits is a black and white image
+type qrBits struct {
+	w, h int
+	dark []bool
+}
+
+func (b *qrBits) get(x, y int) bool {
+	return x >= 0 && y >= 0 && x < b.w && y < b.h && b.dark[y*b.w+x]
+}
+
+// qrFinder is a candidate finder pattern: its centre and module size in pixels
+type qrFinder struct {
+	x, y   float64
+	module float64
+	count  int
+}
+
+// decode locates the three finder patterns and decodes the symbol between them
+func (b *qrBits) decode() (string, error) {
+	finders := b.findFinders()
+	if len(finders) < 3 {
+		return "", errNoQRCode
+	}
+
+	triples := qrFinderTriples(finders)
+	if len(triples) == 0 {
+		return "", errNoQRCode
+	}
+
+	var lastErr error
+	for i, t := range triples {
+		if i == qrMaxAttempts {
+			break
+		}
+		tl, tr, bl := t[0], t[1], t[2]
+		for _, size := range qrSymbolSizes(tl, tr, bl) {
+			text, err := decodeQRGrid(b.sample(tl, tr, bl, size))
+			if err == nil {
+				return text, nil
+			}
+			if lastErr == nil {
+				lastErr = err
+			}
+		}
+	}
+	return "", lastErr
+}
+
+// findFinders scans rows for the 1:1:3:1:1 dark/light runs of a finder pattern,
+// confirms them vertically and horizontally and merges repeated hits
+func (b *qrBits) findFinders() []qrFinder {
+	var finders []qrFinder
+	for y := 0; y < b.h; y++ {
+		var counts [5]int
+		state := 0
+		for x := 0; x < b.w; x++ {
+			dark := b.get(x, y)
+			switch {
+			case dark && state%2 == 1, !dark && state%2 == 0 && state < 4:
+				// Colour change, move to the next run
+				state++
+				counts[state]++
+			case !dark && state == 4:
+				if qrFinderRatio(counts) {
+					finders = b.checkFinder(finders, counts, x, y)
+				}
+				// Keep the last dark, light and dark runs as the start of the next candidate
+				counts = [5]int{counts[2], counts[3], counts[4], 1, 0}
+				state = 3
+			default:
+				counts[state]++
+			}
+		}
+		if state == 4 && qrFinderRatio(counts) {
+			finders = b.checkFinder(finders, counts, b.w, y)
+		}
+	}
+
+	sort.SliceStable(finders, func(i, j int) bool { return finders[i].count > finders[j].count })
+	return finders
+}
+
+// qrFinderRatio reports whether runs are close to 1:1:3:1:1
+func qrFinderRatio(counts [5]int) bool {
+	total := 0
+	for _, c := range counts {
+		if c == 0 {
+			return false
+		}
+		total += c
+	}
+	if total < 7 {
+		return false
+	}
+	module := float64(total) / 7
+	variance := module / 2
+	return math.Abs(module-float64(counts[0])) < variance &&
+		math.Abs(module-float64(counts[1])) < variance &&
+		math.Abs(3*module-float64(counts[2])) < 3*variance &&
+		math.Abs(module-float64(counts[3])) < variance &&
+		math.Abs(module-float64(counts[4])) < variance
+}
+
+// checkFinder cross-checks a horizontal hit ending at endX and adds or merges it
+func (b *qrBits) checkFinder(finders []qrFinder, counts [5]int, endX, y int) []qrFinder {
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	cx := float64(endX-counts[4]-counts[3]) - float64(counts[2])/2
+
+	cy, vTotal, ok := b.crossCheck(int(cx), y, false, counts[2], total)
+	if !ok {
+		return finders
+	}
+	cx, hTotal, ok := b.crossCheck(int(cy), int(cx), true, counts[2], total)
+	if !ok {
+		return finders
+	}
+	module := float64(vTotal+hTotal) / 14
+
+	for i, f := range finders {
+		if math.Abs(f.x-cx) <= module && math.Abs(f.y-cy) <= module &&
+			math.Abs(f.module-module) <= math.Max(1, module/2) {
+			n := float64(f.count)
+			finders[i] = qrFinder{
+				x:      (f.x*n + cx) / (n + 1),
+				y:      (f.y*n + cy) / (n + 1),
+				module: (f.module*n + module) / (n + 1),
+				count:  f.count + 1,
+			}
+			return finders
+		}
+	}
+	return append(finders, qrFinder{x: cx, y: cy, module: module, count: 1})
+}
+
+// crossCheck scans through a candidate centre along one axis. For a horizontal scan fixed is the row
+// and at the column, for a vertical scan the reverse. It returns the centre on the scanned axis.
+func (b *qrBits) crossCheck(fixed, at int, horizontal bool, maxCount, originalTotal int) (float64, int, bool) {
+	dark := func(i int) bool {
+		if horizontal {
+			return b.get(i, fixed)
+		}
+		return b.get(fixed, i)
+	}
+	limit := b.h
+	if horizontal {
+		limit = b.w
+	}
+
+	var counts [5]int
+	i := at
+	for i >= 0 && dark(i) {
+		counts[2]++
+		i--
+	}
+	for i >= 0 && !dark(i) && counts[1] <= maxCount {
+		counts[1]++
+		i--
+	}
+	for i >= 0 && dark(i) && counts[0] <= maxCount {
+		counts[0]++
+		i--
+	}
+	if i < 0 || counts[1] > maxCount || counts[0] > maxCount {
+		return 0, 0, false
+	}
+
+	i = at + 1
+	for i < limit && dark(i) {
+		counts[2]++
+		i++
+	}
+	for i < limit && !dark(i) && counts[3] <= maxCount {
+		counts[3]++
+		i++
+	}
+	for i < limit && dark(i) && counts[4] <= maxCount {
+		counts[4]++
+		i++
+	}
+	if i >= limit || counts[3] > maxCount || counts[4] > maxCount {
+		return 0, 0, false
+	}
+
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	if 5*abs(total-originalTotal) >= 2*originalTotal || !qrFinderRatio(counts) {
+		return 0, 0, false
+	}
+	return float64(i-counts[4]-counts[3]) - float64(counts[2])/2, total, true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// qrFinderTriples returns plausible top-left, top-right, bottom-left finder combinations, best first.
+// The three finders of a symbol have the same module size and form a right isosceles triangle.
+func qrFinderTriples(finders []qrFinder) [][3]qrFinder {
+	// Patterns seen on several rows are far more likely to be real
+	var confirmed []qrFinder
+	for _, f := range finders {
+		if f.count >= 2 {
+			confirmed = append(confirmed, f)
+		}
+	}
+	if len(confirmed) >= 3 {
+		finders = confirmed
+	}
+	if len(finders) > 12 {
+		finders = finders[:12]
+	}
+
+	type scored struct {
+		triple [3]qrFinder
+		score  float64
+	}
+	var candidates []scored
+	for i := 0; i < len(finders); i++ {
+		for j := i + 1; j < len(finders); j++ {
+			for k := j + 1; k < len(finders); k++ {
+				triple, score, ok := qrOrderFinders(finders[i], finders[j], finders[k])
+				if ok {
+					candidates = append(candidates, scored{triple, score})
+				}
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score < candidates[j].score })
+
+	triples := make([][3]qrFinder, len(candidates))
+	for i, c := range candidates {
+		triples[i] = c.triple
+	}
+	return triples
+}
+
+// qrOrderFinders orders three finders as top-left, top-right, bottom-left and scores how well they fit
+func qrOrderFinders(a, b, c qrFinder) ([3]qrFinder, float64, bool) {
+	smallest := math.Min(a.module, math.Min(b.module, c.module))
+	largest := math.Max(a.module, math.Max(b.module, c.module))
+	if largest > smallest*1.5 {
+		return [3]qrFinder{}, 0, false
+	}
+
+	// The top-left finder is the corner opposite the longest side
+	ab, bc, ca := qrDistance(a, b), qrDistance(b, c), qrDistance(c, a)
+	var tl, p, q qrFinder
+	var legA, legB, hypotenuse float64
+	switch {
+	case bc >= ab && bc >= ca:
+		tl, p, q, legA, legB, hypotenuse = a, b, c, ab, ca, bc
+	case ca >= ab && ca >= bc:
+		tl, p, q, legA, legB, hypotenuse = b, c, a, ab, bc, ca
+	default:
+		tl, p, q, legA, legB, hypotenuse = c, a, b, bc, ca, ab
+	}
+
+	module := (a.module + b.module + c.module) / 3
+	if math.Min(legA, legB) < 12*module {
+		return [3]qrFinder{}, 0, false
+	}
+	legError := math.Abs(legA-legB) / math.Max(legA, legB)
+	angleError := math.Abs(hypotenuse-math.Hypot(legA, legB)) / hypotenuse
+	if legError > 0.2 || angleError > 0.1 {
+		return [3]qrFinder{}, 0, false
+	}
+
+	// Top-right is clockwise from top-left with y pointing down
+	if (p.x-tl.x)*(q.y-tl.y)-(p.y-tl.y)*(q.x-tl.x) < 0 {
+		p, q = q, p
+	}
+	return [3]qrFinder{tl, p, q}, legError + angleError + (largest-smallest)/largest, true
+}
+
+func qrDistance(a, b qrFinder) float64 {
+	return math.Hypot(a.x-b.x, a.y-b.y)
+}
+
+// qrSymbolSizes returns the symbol sizes (modules per side) to try, the estimate from the finder distance first
+func qrSymbolSizes(tl, tr, bl qrFinder) []int {
+	module := (tl.module + tr.module + bl.module) / 3
+	modules := (qrDistance(tl, tr)+qrDistance(tl, bl))/(2*module) + 7
+	version := int(math.Round((modules - 17) / 4))
+
+	var sizes []int
+	for _, v := range []int{version, version - 1, version + 1} {
+		if v >= 1 && v <= 40 {
+			sizes = append(sizes, 17+4*v)
+		}
+	}
+	return sizes
+}
+
+// sample reads the module centres of a symbol of the given size, mapped from the finder centres
+func (b *qrBits) sample(tl, tr, bl qrFinder, size int) *qrGrid {
+	// Finder centres are 3.5 modules in from the symbol edges
+	n := float64(size - 7)
+	colX, colY := (tr.x-tl.x)/n, (tr.y-tl.y)/n
+	rowX, rowY := (bl.x-tl.x)/n, (bl.y-tl.y)/n
+
+	grid := newQRGrid(size)
+	for r := 0; r < size; r++ {
+		for c := 0; c < size; c++ {
+			u, v := float64(c)-3, float64(r)-3
+			x := tl.x + u*colX + v*rowX
+			y := tl.y + u*colY + v*rowY
+			grid.dark[r*size+c] = b.get(int(math.Floor(x)), int(math.Floor(y)))
+		}
+	}
+	return grid
+}
@@ -0,0 +1,555 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+	"unicode/utf8"
+)
+
+// qrGrid holds the modules of a QR code symbol, true for dark
+type qrGrid struct {
+	size int
+	dark []bool
+}
+
+func newQRGrid(size int) *qrGrid {
+	return &qrGrid{size: size, dark: make([]bool, size*size)}
+}
+
+func (g *qrGrid) get(row, col int) bool {
+	return g.dark[row*g.size+col]
+}
+
+// QR code error correction tables (ISO/IEC 18004 table 9), indexed by level L, M, Q, H and version
+var (
+	qrECCodewordsPerBlock = [4][41]int{
+		{0, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+		{0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+		{0, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+		{0, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	}
+	qrECBlocks = [4][41]int{
+		{0, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+		{0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+		{0, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+		{0, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+	}
+)
+
+// qrLevelIndex maps the error correction bits of the format information to the table index
+var qrLevelIndex = [4]int{1, 0, 3, 2} // 00 M, 01 L, 10 H, 11 Q
+
+// decodeQRGrid reads the format information, unmasks the data, corrects errors and decodes the text
+func decodeQRGrid(g *qrGrid) (string, error) {
+	version := (g.size - 17) / 4
+	level, mask, err := g.formatInfo()
+	if err != nil {
+		return "", err
+	}
+	if version >= 7 {
+		// The version information confirms the size estimated from the finder patterns
+		if v, err := g.versionInfo(); err != nil || v != version {
+			return "", fmt.Errorf("QR version %d not confirmed by the symbol", version)
+		}
+	}
+
+	codewords := g.codewords(version, mask)
+	data, err := qrCorrect(codewords, version, level)
+	if err != nil {
+		return "", err
+	}
+	return qrDecodeData(data, version)
+}
+
+// formatInfo returns the error correction level index and mask from either copy of the format bits
+func (g *qrGrid) formatInfo() (int, int, error) {
+	size := g.size
+	var first, second int
+	bit := func(value *int, i int, dark bool) {
+		if dark {
+			*value |= 1 << i
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		bit(&first, i, g.get(i, 8))
+	}
+	bit(&first, 6, g.get(7, 8))
+	bit(&first, 7, g.get(8, 8))
+	bit(&first, 8, g.get(8, 7))
+	for i := 9; i < 15; i++ {
+		bit(&first, i, g.get(8, 14-i))
+	}
+	for i := 0; i < 8; i++ {
+		bit(&second, i, g.get(8, size-1-i))
+	}
+	for i := 8; i < 15; i++ {
+		bit(&second, i, g.get(size-15+i, 8))
+	}
+
+	best, bestDistance := 0, 16
+	for data := 0; data < 32; data++ {
+		rem := data
+		for i := 0; i < 10; i++ {
+			rem = rem<<1 ^ (rem>>9)*0x537
+		}
+		code := (data<<10 | rem) ^ 0x5412
+		for _, read := range []int{first, second} {
+			if d := bits.OnesCount(uint(code ^ read)); d < bestDistance {
+				best, bestDistance = data, d
+			}
+		}
+	}
+	if bestDistance > 3 {
+		return 0, 0, errors.New("QR format information unreadable")
+	}
+	return qrLevelIndex[best>>3], best & 7, nil
+}
+
+// versionInfo reads the version from either copy of the version bits (versions 7 and up)
+func (g *qrGrid) versionInfo() (int, error) {
+	var first, second int
+	for i := 0; i < 18; i++ {
+		a, b := g.size-11+i%3, i/3
+		if g.get(b, a) {
+			first |= 1 << i
+		}
+		if g.get(a, b) {
+			second |= 1 << i
+		}
+	}
+
+	best, bestDistance := 0, 19
+	for version := 7; version <= 40; version++ {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = rem<<1 ^ (rem>>11)*0x1F25
+		}
+		code := version<<12 | rem
+		for _, read := range []int{first, second} {
+			if d := bits.OnesCount(uint(code ^ read)); d < bestDistance {
+				best, bestDistance = version, d
+			}
+		}
+	}
+	if bestDistance > 3 {
+		return 0, errors.New("QR version information unreadable")
+	}
+	return best, nil
+}
+
+// qrAlignmentPositions returns the row and column coordinates of the alignment patterns of a version
+func qrAlignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	count := version/7 + 2
+	step := (version*4 + count*2 + 1) / (count*2 - 2) * 2
+	if version == 32 {
+		step = 26
+	}
+	positions := make([]int, count)
+	positions[0] = 6
+	for i, pos := count-1, 17+4*version-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// qrFunctionModules marks the finder, timing, alignment, format and version modules of a version
+func qrFunctionModules(version int) *qrGrid {
+	size := 17 + 4*version
+	g := newQRGrid(size)
+	fill := func(row, col, height, width int) {
+		for r := row; r < row+height; r++ {
+			for c := col; c < col+width; c++ {
+				g.dark[r*size+c] = true
+			}
+		}
+	}
+
+	// Finder patterns with separators and format information
+	fill(0, 0, 9, 9)
+	fill(0, size-8, 9, 8)
+	fill(size-8, 0, 8, 9)
+	// Timing patterns
+	fill(6, 0, 1, size)
+	fill(0, 6, size, 1)
+
+	positions := qrAlignmentPositions(version)
+	last := len(positions) - 1
+	for i, row := range positions {
+		for j, col := range positions {
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			fill(row-2, col-2, 5, 5)
+		}
+	}
+
+	if version >= 7 {
+		fill(0, size-11, 6, 3)
+		fill(size-11, 0, 3, 6)
+	}
+	return g
+}
+
+// qrMasked reports whether a data module at row, col is inverted by a mask pattern
+func qrMasked(mask, row, col int) bool {
+	switch mask {
+	case 0:
+		return (row+col)%2 == 0
+	case 1:
+		return row%2 == 0
+	case 2:
+		return col%3 == 0
+	case 3:
+		return (row+col)%3 == 0
+	case 4:
+		return (row/2+col/3)%2 == 0
+	case 5:
+		return row*col%2+row*col%3 == 0
+	case 6:
+		return (row*col%2+row*col%3)%2 == 0
+	default:
+		return ((row+col)%2+row*col%3)%2 == 0
+	}
+}
+
+// codewords reads the unmasked data and error correction codewords in placement order:
+// two-module columns from the right, alternately upwards and downwards, skipping the timing column
+func (g *qrGrid) codewords(version, mask int) []byte {
+	function := qrFunctionModules(version)
+	size := g.size
+	codewords := make([]byte, 0, size*size/8)
+
+	var current byte
+	n := 0
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < size; vert++ {
+			row := vert
+			if upward {
+				row = size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				col := right - j
+				if function.get(row, col) {
+					continue
+				}
+				current <<= 1
+				if g.get(row, col) != qrMasked(mask, row, col) {
+					current |= 1
+				}
+				if n++; n == 8 {
+					codewords = append(codewords, current)
+					current, n = 0, 0
+				}
+			}
+		}
+	}
+	return codewords
+}
+
+// qrCorrect splits interleaved codewords into blocks, corrects each block and returns the data codewords
+func qrCorrect(codewords []byte, version, level int) ([]byte, error) {
+	numBlocks := qrECBlocks[level][version]
+	ecLen := qrECCodewordsPerBlock[level][version]
+	total := len(codewords)
+	shortBlocks := numBlocks - total%numBlocks
+	shortLen := total / numBlocks
+
+	// Short blocks have one data codeword less, they skip that position while interleaving
+	blocks := make([][]byte, numBlocks)
+	for i := range blocks {
+		blocks[i] = make([]byte, shortLen+1)
+	}
+	next := 0
+	for i := 0; i <= shortLen; i++ {
+		for j := range blocks {
+			if i == shortLen-ecLen && j < shortBlocks {
+				continue
+			}
+			blocks[j][i] = codewords[next]
+			next++
+		}
+	}
+
+	var data []byte
+	for j, block := range blocks {
+		if j < shortBlocks {
+			block = append(block[:shortLen-ecLen], block[shortLen-ecLen+1:]...)
+		}
+		if err := rsCorrect(block, ecLen); err != nil {
+			return nil, err
+		}
+		data = append(data, block[:len(block)-ecLen]...)
+	}
+	return data, nil
+}
+
+// GF(256) tables for the QR code field, primitive polynomial x^8 + x^4 + x^3 + x^2 + 1
+var gfExp, gfLog = func() (exp [512]byte, log [256]int) {
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+gfLog[b]]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+255-gfLog[b]]
+}
+
+// gfEval evaluates a polynomial with the lowest degree coefficient first
+func gfEval(poly []byte, x byte) byte {
+	var y byte
+	for i := len(poly) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ poly[i]
+	}
+	return y
+}
+
+// rsCorrect corrects a Reed-Solomon block in place (Berlekamp-Massey, Chien search and Forney)
+func rsCorrect(block []byte, ecLen int) error {
+	n := len(block)
+
+	// The first codeword is the highest degree coefficient
+	syndromes := make([]byte, ecLen)
+	clean := true
+	for i := range syndromes {
+		var s byte
+		for _, c := range block {
+			s = gfMul(s, gfExp[i]) ^ c
+		}
+		syndromes[i] = s
+		clean = clean && s == 0
+	}
+	if clean {
+		return nil
+	}
+
+	// Error locator polynomial
+	locator, previous := []byte{1}, []byte{1}
+	errorsFound, shift, lastDiscrepancy := 0, 1, byte(1)
+	for i := 0; i < ecLen; i++ {
+		discrepancy := syndromes[i]
+		for j := 1; j <= errorsFound && j < len(locator); j++ {
+			discrepancy ^= gfMul(locator[j], syndromes[i-j])
+		}
+		if discrepancy == 0 {
+			shift++
+			continue
+		}
+
+		scale := gfDiv(discrepancy, lastDiscrepancy)
+		updated := make([]byte, max(len(locator), len(previous)+shift))
+		copy(updated, locator)
+		for j, c := range previous {
+			updated[j+shift] ^= gfMul(scale, c)
+		}
+		if 2*errorsFound <= i {
+			previous, errorsFound, lastDiscrepancy, shift = locator, i+1-errorsFound, discrepancy, 1
+		} else {
+			shift++
+		}
+		locator = updated
+	}
+	if 2*errorsFound > ecLen {
+		return errors.New("QR code too damaged to correct")
+	}
+
+	// Error evaluator, S(x) * locator(x) mod x^ecLen
+	evaluator := make([]byte, ecLen)
+	for i := range evaluator {
+		for j := 0; j <= i && j < len(locator); j++ {
+			evaluator[i] ^= gfMul(locator[j], syndromes[i-j])
+		}
+	}
+
+	// Formal derivative of the locator
+	derivative := make([]byte, len(locator))
+	for j := 1; j < len(locator); j += 2 {
+		derivative[j-1] = locator[j]
+	}
+
+	found := 0
+	for pos := 0; pos < n; pos++ {
+		power := n - 1 - pos
+		inverse := gfExp[(255-power)%255]
+		if gfEval(locator, inverse) != 0 {
+			continue
+		}
+		denominator := gfEval(derivative, inverse)
+		if denominator == 0 {
+			return errors.New("QR code too damaged to correct")
+		}
+		block[pos] ^= gfMul(gfExp[power], gfDiv(gfEval(evaluator, inverse), denominator))
+		found++
+	}
+	if found != errorsFound {
+		return errors.New("QR code too damaged to correct")
+	}
+	return nil
+}
+
+// qrBitReader reads big-endian bit fields from the data codewords
+type qrBitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *qrBitReader) remaining() int {
+	return len(r.data)*8 - r.pos
+}
+
+func (r *qrBitReader) read(n int) (int, error) {
+	if n > r.remaining() {
+		return 0, errors.New("QR data truncated")
+	}
+	value := 0
+	for i := 0; i < n; i++ {
+		bit := r.data[r.pos/8] >> (7 - r.pos%8) & 1
+		value = value<<1 | int(bit)
+		r.pos++
+	}
+	return value, nil
+}
+
+// qrAlphanumeric is the character set of the alphanumeric mode
+const qrAlphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// qrDecodeData decodes the segments of the data codewords (numeric, alphanumeric and byte modes)
+func qrDecodeData(data []byte, version int) (string, error) {
+	group := 0
+	if version >= 27 {
+		group = 2
+	} else if version >= 10 {
+		group = 1
+	}
+	countBits := map[int][3]int{
+		0x1: {10, 12, 14}, // numeric
+		0x2: {9, 11, 13},  // alphanumeric
+		0x4: {8, 16, 16},  // byte
+	}
+
+	r := &qrBitReader{data: data}
+	var raw []byte
+	for r.remaining() >= 4 {
+		mode, _ := r.read(4)
+		if mode == 0 {
+			break // terminator
+		}
+
+		switch mode {
+		case 0x3: // structured append: symbol index and parity
+			if _, err := r.read(16); err != nil {
+				return "", err
+			}
+			continue
+		case 0x5: // FNC1 in first position
+			continue
+		case 0x9: // FNC1 in second position: application indicator
+			if _, err := r.read(8); err != nil {
+				return "", err
+			}
+			continue
+		case 0x7: // ECI designator, the text is assumed to be ASCII or UTF-8
+			first, err := r.read(8)
+			if err != nil {
+				return "", err
+			}
+			extra := 0
+			if first&0x80 != 0 {
+				extra = 1
+				if first&0x40 != 0 {
+					extra = 2
+				}
+			}
+			if _, err := r.read(8 * extra); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		bitsPerCount, ok := countBits[mode]
+		if !ok {
+			return "", fmt.Errorf("unsupported QR data mode %d", mode)
+		}
+		count, err := r.read(bitsPerCount[group])
+		if err != nil {
+			return "", err
+		}
+
+		switch mode {
+		case 0x1:
+			for ; count > 0; count -= 3 {
+				digits := min(count, 3)
+				value, err := r.read([4]int{0, 4, 7, 10}[digits])
+				if err != nil {
+					return "", err
+				}
+				raw = fmt.Appendf(raw, "%0*d", digits, value)
+			}
+		case 0x2:
+			for ; count > 0; count -= 2 {
+				if count == 1 {
+					value, err := r.read(6)
+					if err != nil || value >= 45 {
+						return "", errors.New("invalid QR alphanumeric data")
+					}
+					raw = append(raw, qrAlphanumeric[value])
+					break
+				}
+				value, err := r.read(11)
+				if err != nil || value >= 45*45 {
+					return "", errors.New("invalid QR alphanumeric data")
+				}
+				raw = append(raw, qrAlphanumeric[value/45], qrAlphanumeric[value%45])
+			}
+		case 0x4:
+			for i := 0; i < count; i++ {
+				value, err := r.read(8)
+				if err != nil {
+					return "", err
+				}
+				raw = append(raw, byte(value))
+			}
+		}
+	}
+
+	// Byte mode is UTF-8 in practice, ISO 8859-1 by the standard
+	if utf8.Valid(raw) {
+		return string(raw), nil
+	}
+	var text strings.Builder
+	for _, b := range raw {
+		text.WriteRune(rune(b))
+	}
+	return text.String(), nil
+}
@@ -0,0 +1,682 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var updateQRFixtures = flag.Bool("update", false, "regenerate the QR image fixtures in testdata/qr")
+
+// QR data modes
+const (
+	qrModeNumeric      = 0x1
+	qrModeAlphanumeric = 0x2
+	qrModeByte         = 0x4
+)
+
+// QR error correction levels as indexes into the decoder tables
+const (
+	qrLevelL = iota
+	qrLevelM
+	qrLevelQ
+	qrLevelH
+)
+
+// qrFormatLevelBits are the error correction bits of the format information, by level index
+var qrFormatLevelBits = [4]int{1, 0, 3, 2}
+
+// qrTestSymbol is a symbol built by the test encoder, modules indexed [y][x]
+type qrTestSymbol struct {
+	size     int
+	modules  [][]bool
+	function [][]bool
+	inverted bool // rendered light on dark
+}
+
+func (s *qrTestSymbol) set(x, y int, dark bool) {
+	s.modules[y][x] = dark
+	s.function[y][x] = true
+}
+
+// grid returns the symbol as the decoder sees it after sampling
+func (s *qrTestSymbol) grid() *qrGrid {
+	g := newQRGrid(s.size)
+	for y, row := range s.modules {
+		for x, dark := range row {
+			g.dark[y*s.size+x] = dark
+		}
+	}
+	return g
+}
+
+// qrRawCodewords counts the codewords of a version from its data modules (ISO/IEC 18004 table 1)
+func qrRawCodewords(version int) int {
+	modules := (16*version+128)*version + 64
+	if version >= 2 {
+		alignments := version/7 + 2
+		modules -= (25*alignments-10)*alignments - 55
+		if version >= 7 {
+			modules -= 36
+		}
+	}
+	return modules / 8
+}
+
+func qrDataCodewords(version, level int) int {
+	return qrRawCodewords(version) - qrECBlocks[level][version]*qrECCodewordsPerBlock[level][version]
+}
+
+// qrTestMul multiplies in GF(256) bit by bit, independently of the decoder tables
+func qrTestMul(x, y byte) byte {
+	var z byte
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ z>>7*0x1D
+		z ^= (y >> i & 1) * x
+	}
+	return z
+}
+
+// qrTestECC returns the Reed-Solomon error correction codewords of a block
+func qrTestECC(data []byte, degree int) []byte {
+	divisor := make([]byte, degree)
+	divisor[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range divisor {
+			divisor[j] = qrTestMul(divisor[j], root)
+			if j+1 < degree {
+				divisor[j] ^= divisor[j+1]
+			}
+		}
+		root = qrTestMul(root, 2)
+	}
+
+	remainder := make([]byte, degree)
+	for _, b := range data {
+		factor := b ^ remainder[0]
+		copy(remainder, remainder[1:])
+		remainder[degree-1] = 0
+		for i, coef := range divisor {
+			remainder[i] ^= qrTestMul(coef, factor)
+		}
+	}
+	return remainder
+}
+
+// qrTestDataCodewords encodes text as a single segment, or returns false if it does not fit
+func qrTestDataCodewords(text string, mode, version, level int) ([]byte, bool) {
+	var bits []bool
+	put := func(value, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, value>>i&1 == 1)
+		}
+	}
+
+	group := 0
+	if version >= 27 {
+		group = 2
+	} else if version >= 10 {
+		group = 1
+	}
+	put(mode, 4)
+	switch mode {
+	case qrModeNumeric:
+		put(len(text), [3]int{10, 12, 14}[group])
+		for i := 0; i < len(text); i += 3 {
+			digits := text[i:min(i+3, len(text))]
+			value := 0
+			for _, d := range digits {
+				value = value*10 + int(d-'0')
+			}
+			put(value, [4]int{0, 4, 7, 10}[len(digits)])
+		}
+	case qrModeAlphanumeric:
+		put(len(text), [3]int{9, 11, 13}[group])
+		for i := 0; i < len(text); i += 2 {
+			if i+1 == len(text) {
+				put(strings.IndexByte(qrAlphanumeric, text[i]), 6)
+			} else {
+				put(strings.IndexByte(qrAlphanumeric, text[i])*45+strings.IndexByte(qrAlphanumeric, text[i+1]), 11)
+			}
+		}
+	default:
+		put(len(text), [3]int{8, 16, 16}[group])
+		for i := 0; i < len(text); i++ {
+			put(int(text[i]), 8)
+		}
+	}
+
+	capacity := qrDataCodewords(version, level) * 8
+	if len(bits) > capacity {
+		return nil, false
+	}
+	put(0, min(4, capacity-len(bits)))
+	put(0, (8-len(bits)%8)%8)
+
+	data := make([]byte, 0, capacity/8)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for _, bit := range bits[i : i+8] {
+			b <<= 1
+			if bit {
+				b |= 1
+			}
+		}
+		data = append(data, b)
+	}
+	for pad := byte(0xEC); len(data) < capacity/8; pad ^= 0xEC ^ 0x11 {
+		data = append(data, pad)
+	}
+	return data, true
+}
+
+// qrTestInterleave adds the error correction codewords and interleaves the blocks
+func qrTestInterleave(data []byte, version, level int) []byte {
+	numBlocks := qrECBlocks[level][version]
+	ecLen := qrECCodewordsPerBlock[level][version]
+	raw := qrRawCodewords(version)
+	shortBlocks := numBlocks - raw%numBlocks
+	shortLen := raw / numBlocks
+
+	var blocks [][]byte
+	for i, k := 0, 0; i < numBlocks; i++ {
+		n := shortLen - ecLen
+		if i >= shortBlocks {
+			n++
+		}
+		block := append([]byte{}, data[k:k+n]...)
+		k += n
+		block = append(block, qrTestECC(block, ecLen)...)
+		if i < shortBlocks {
+			// placeholder where the long blocks carry their extra data codeword
+			block = append(block[:n], append([]byte{0}, block[n:]...)...)
+		}
+		blocks = append(blocks, block)
+	}
+
+	var result []byte
+	for i := 0; i <= shortLen; i++ {
+		for j, block := range blocks {
+			if i != shortLen-ecLen || j >= shortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// qrTestFormatBits returns the 15 format bits of a level and mask
+func qrTestFormatBits(level, mask int) int {
+	data := qrFormatLevelBits[level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// qrTestVersionBits returns the 18 version bits of a version
+func qrTestVersionBits(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return version<<12 | rem
+}
+
+// qrTestEncode builds a symbol of the given version, level and mask holding text in one segment
+func qrTestEncode(t *testing.T, text string, mode, version, level, mask int) *qrTestSymbol {
+	t.Helper()
+	data, ok := qrTestDataCodewords(text, mode, version, level)
+	if !ok {
+		t.Fatalf("%q does not fit in version %d level %d", text, version, level)
+	}
+
+	size := 17 + 4*version
+	s := &qrTestSymbol{size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for y := range s.modules {
+		s.modules[y] = make([]bool, size)
+		s.function[y] = make([]bool, size)
+	}
+
+	for i := 0; i < size; i++ {
+		s.set(6, i, i%2 == 0)
+		s.set(i, 6, i%2 == 0)
+	}
+	for _, c := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x >= 0 && y >= 0 && x < size && y < size {
+					d := max(abs(dx), abs(dy))
+					s.set(x, y, d != 2 && d != 4)
+				}
+			}
+		}
+	}
+	positions := qrAlignmentPositions(version)
+	last := len(positions) - 1
+	for i, cy := range positions {
+		for j, cx := range positions {
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue // finder pattern corner
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					s.set(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	format := qrTestFormatBits(level, mask)
+	bit := func(value, i int) bool { return value>>i&1 == 1 }
+	for i := 0; i <= 5; i++ {
+		s.set(8, i, bit(format, i))
+	}
+	s.set(8, 7, bit(format, 6))
+	s.set(8, 8, bit(format, 7))
+	s.set(7, 8, bit(format, 8))
+	for i := 9; i < 15; i++ {
+		s.set(14-i, 8, bit(format, i))
+	}
+	for i := 0; i < 8; i++ {
+		s.set(size-1-i, 8, bit(format, i))
+	}
+	for i := 8; i < 15; i++ {
+		s.set(8, size-15+i, bit(format, i))
+	}
+	s.set(8, size-8, true)
+
+	if version >= 7 {
+		bits := qrTestVersionBits(version)
+		for i := 0; i < 18; i++ {
+			a, b := size-11+i%3, i/3
+			s.set(a, b, bit(bits, i))
+			s.set(b, a, bit(bits, i))
+		}
+	}
+
+	codewords := qrTestInterleave(data, version, level)
+	i := 0
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = size - 1 - vert
+				}
+				if s.function[y][x] {
+					continue
+				}
+				if i < len(codewords)*8 {
+					s.modules[y][x] = codewords[i/8]>>(7-i%8)&1 == 1
+					i++
+				}
+			}
+		}
+	}
+
+	masks := [8]func(x, y int) bool{
+		func(x, y int) bool { return (x+y)%2 == 0 },
+		func(x, y int) bool { return y%2 == 0 },
+		func(x, y int) bool { return x%3 == 0 },
+		func(x, y int) bool { return (x+y)%3 == 0 },
+		func(x, y int) bool { return (x/3+y/2)%2 == 0 },
+		func(x, y int) bool { return x*y%2+x*y%3 == 0 },
+		func(x, y int) bool { return (x*y%2+x*y%3)%2 == 0 },
+		func(x, y int) bool { return ((x+y)%2+x*y%3)%2 == 0 },
+	}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if !s.function[y][x] && masks[mask](x, y) {
+				s.modules[y][x] = !s.modules[y][x]
+			}
+		}
+	}
+	return s
+}
+
+// fill paints a square of data modules, damaging the symbol
+func (s *qrTestSymbol) fill(x, y, n int, dark bool) {
+	for dy := 0; dy < n; dy++ {
+		for dx := 0; dx < n; dx++ {
+			s.modules[y+dy][x+dx] = dark
+		}
+	}
+}
+
+// rotate turns the symbol clockwise by quarter turns
+func (s *qrTestSymbol) rotate(turns int) *qrTestSymbol {
+	for ; turns > 0; turns-- {
+		rotated := make([][]bool, s.size)
+		for y := range rotated {
+			rotated[y] = make([]bool, s.size)
+			for x := range rotated[y] {
+				rotated[y][x] = s.modules[s.size-1-x][y]
+			}
+		}
+		s = &qrTestSymbol{size: s.size, modules: rotated, inverted: s.inverted}
+	}
+	return s
+}
+
+// render draws the symbol with a four module quiet zone, scale pixels per module
+func (s *qrTestSymbol) render(scale int) *image.Gray {
+	side := (s.size + 8) * scale
+	img := image.NewGray(image.Rect(0, 0, side, side))
+	for py := 0; py < side; py++ {
+		for px := 0; px < side; px++ {
+			x, y := px/scale-4, py/scale-4
+			dark := x >= 0 && y >= 0 && x < s.size && y < s.size && s.modules[y][x]
+			if dark == s.inverted {
+				img.SetGray(px, py, color.Gray{Y: 0xff})
+			}
+		}
+	}
+	return img
+}
+
+// qrFixture is an image in testdata/qr and the text it must decode to,
+// or the reason it must be rejected for
+type qrFixture struct {
+	file   string
+	text   string
+	reject string
+	image  func(t *testing.T) []byte
+}
+
+// qrFixtureTexts are candidate payloads, the first one that fits a symbol is used
+var qrFixtureTexts = []struct {
+	text string
+	mode int
+}{
+	{"LPA:1$rsp.example.com$04386-AGYFT-A74Y8-3F815$1.3.6.1.4.1.31746$1", qrModeByte},
+	{"LPA:1$SMDP.EXAMPLE.COM$04386-AGYFT-A74Y8-3F815", qrModeAlphanumeric},
+	{"LPA:1$A.IO$X", qrModeAlphanumeric},
+	{"20250101", qrModeNumeric},
+}
+
+// qrFixtureText picks the payload of a symbol
+func qrFixtureText(version, level int) (string, int) {
+	for _, c := range qrFixtureTexts {
+		if _, ok := qrTestDataCodewords(c.text, c.mode, version, level); ok {
+			return c.text, c.mode
+		}
+	}
+	panic(fmt.Sprintf("no fixture text fits version %d level %d", version, level))
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 75}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// qrSymbolFixture is a symbol rendered at scale, changed by edit before rendering
+func qrSymbolFixture(file string, version, level, mask, scale int, edit func(*qrTestSymbol) *qrTestSymbol) qrFixture {
+	text, mode := qrFixtureText(version, level)
+	return qrFixture{file: file, text: text, image: func(t *testing.T) []byte {
+		s := qrTestEncode(t, text, mode, version, level, mask)
+		if edit != nil {
+			s = edit(s)
+		}
+		img := s.render(scale)
+		if filepath.Ext(file) == ".jpg" {
+			return encodeJPEG(t, img)
+		}
+		return encodePNG(t, img)
+	}}
+}
+
+// qrDamage overwrites the bottom right n by n modules with light modules,
+// where the placement starts with the first data codeword of each block
+func qrDamage(n int) func(*qrTestSymbol) *qrTestSymbol {
+	return func(s *qrTestSymbol) *qrTestSymbol {
+		s.fill(s.size-n, s.size-n, n, false)
+		return s
+	}
+}
+
+// qrFixtures lists the golden images: every mask at every level over several versions,
+// JPEG, inverted, rotated and damaged symbols, and images that must be rejected
+func qrFixtures() []qrFixture {
+	levels := "LMQH"
+	versions := []int{1, 2, 4, 7, 10, 15}
+	var fixtures []qrFixture
+	for level := qrLevelL; level <= qrLevelH; level++ {
+		for mask := 0; mask < 8; mask++ {
+			version := versions[(level*8+mask)%len(versions)]
+			file := fmt.Sprintf("v%d-%c-mask%d.png", version, levels[level], mask)
+			fixtures = append(fixtures, qrSymbolFixture(file, version, level, mask, 4, nil))
+		}
+		file := fmt.Sprintf("v3-%c-mask%d.jpg", levels[level], level*2+1)
+		fixtures = append(fixtures, qrSymbolFixture(file, 3, level, level*2+1, 5, nil))
+	}
+
+	fixtures = append(fixtures,
+		qrSymbolFixture("v3-Q-mask2-inverted.png", 3, qrLevelQ, 2, 4, func(s *qrTestSymbol) *qrTestSymbol {
+			s.inverted = true
+			return s
+		}),
+		qrSymbolFixture("v5-M-mask6-rotated90.png", 5, qrLevelM, 6, 4, func(s *qrTestSymbol) *qrTestSymbol { return s.rotate(1) }),
+		qrSymbolFixture("v5-L-mask4-rotated180.jpg", 5, qrLevelL, 4, 6, func(s *qrTestSymbol) *qrTestSymbol { return s.rotate(2) }),
+		qrSymbolFixture("v1-M-mask1-small.png", 1, qrLevelM, 1, 2, nil),
+		qrSymbolFixture("v4-H-mask3-damaged.png", 4, qrLevelH, 3, 4, qrDamage(5)),
+		qrSymbolFixture("v7-Q-mask5-damaged.jpg", 7, qrLevelQ, 5, 4, qrDamage(5)),
+	)
+
+	reject := func(f qrFixture, reason string) qrFixture {
+		f.text, f.reject = "", reason
+		return f
+	}
+	fixtures = append(fixtures,
+		reject(qrSymbolFixture("reject-v2-L-mask0-too-damaged.png", 2, qrLevelL, 0, 4, qrDamage(9)), "too damaged"),
+		reject(qrSymbolFixture("reject-v3-M-mask7-no-format.png", 3, qrLevelM, 7, 4, func(s *qrTestSymbol) *qrTestSymbol {
+			for i := 0; i <= 8; i++ {
+				if i != 6 {
+					s.modules[8][i], s.modules[i][8] = false, false
+				}
+			}
+			for i := 0; i < 8; i++ {
+				s.modules[8][s.size-1-i] = false
+			}
+			for i := 0; i < 7; i++ {
+				s.modules[s.size-1-i][8] = false
+			}
+			return s
+		}), "format information unreadable"),
+		qrFixture{file: "reject-blank.png", reject: errNoQRCode.Error(), image: func(t *testing.T) []byte {
+			img := image.NewGray(image.Rect(0, 0, 200, 200))
+			for i := range img.Pix {
+				img.Pix[i] = 0xff
+			}
+			return encodePNG(t, img)
+		}},
+		qrFixture{file: "reject-checkerboard.png", reject: errNoQRCode.Error(), image: func(t *testing.T) []byte {
+			s := &qrTestSymbol{size: 41, modules: make([][]bool, 41)}
+			for y := range s.modules {
+				s.modules[y] = make([]bool, s.size)
+				for x := range s.modules[y] {
+					s.modules[y][x] = (x/3+y/3)%2 == 0
+				}
+			}
+			return encodePNG(t, s.render(4))
+		}},
+		qrFixture{file: "reject-truncated.png", reject: "png:", image: func(t *testing.T) []byte {
+			text, mode := qrFixtureText(2, qrLevelM)
+			data := encodePNG(t, qrTestEncode(t, text, mode, 2, qrLevelM, 0).render(4))
+			return data[:len(data)/2]
+		}},
+		qrFixture{file: "reject-not-an-image.png", reject: "unknown format", image: func(t *testing.T) []byte {
+			return []byte("LPA:1$rsp.example.com$04386-AGYFT-A74Y8-3F815\n")
+		}},
+	)
+	return fixtures
+}
+
+func TestQRDecodeFixtures(t *testing.T) {
+	dir := filepath.Join("testdata", "qr")
+	fixtures := qrFixtures()
+	if *updateQRFixtures {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range fixtures {
+			if err := os.WriteFile(filepath.Join(dir, f.file), f.image(t), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, f := range fixtures {
+		t.Run(f.file, func(t *testing.T) {
+			text, err := decodeQRFile(filepath.Join(dir, f.file))
+			switch {
+			case f.reject == "" && err != nil:
+				t.Fatal(err)
+			case f.reject == "" && text != f.text:
+				t.Fatalf("decoded %q, want %q", text, f.text)
+			case f.reject != "" && err == nil:
+				t.Fatalf("decoded %q, want the image rejected (%s)", text, f.reject)
+			case f.reject != "" && (!errors.Is(err, errInvalidQRImage) || !strings.Contains(err.Error(), f.reject)):
+				t.Fatalf("got %v, want an invalid QR image error (%s)", err, f.reject)
+			}
+		})
+	}
+}
+
+// The damaged fixtures must need the error correction: their data codewords differ from the clean symbol
+func TestQRDamagedFixturesNeedCorrection(t *testing.T) {
+	tests := []struct {
+		version, level, mask, damage int
+		correctable                  bool
+	}{
+		{4, qrLevelH, 3, 5, true},
+		{7, qrLevelQ, 5, 5, true},
+		{2, qrLevelL, 0, 9, false},
+	}
+	for _, tt := range tests {
+		text, mode := qrFixtureText(tt.version, tt.level)
+		clean := qrTestEncode(t, text, mode, tt.version, tt.level, tt.mask).grid().codewords(tt.version, tt.mask)
+		damaged := qrDamage(tt.damage)(qrTestEncode(t, text, mode, tt.version, tt.level, tt.mask)).grid().codewords(tt.version, tt.mask)
+
+		// The interleaved data codewords come first
+		errs, dataErrs := 0, 0
+		for i := range clean {
+			if clean[i] != damaged[i] {
+				errs++
+				if i < qrDataCodewords(tt.version, tt.level) {
+					dataErrs++
+				}
+			}
+		}
+		if errs < 3 || dataErrs < 2 {
+			t.Errorf("version %d: only %d codewords damaged, %d of them data", tt.version, errs, dataErrs)
+		}
+		data, err := qrCorrect(damaged, tt.version, tt.level)
+		if tt.correctable && (err != nil || !bytes.Equal(data, mustDataCodewords(t, text, mode, tt.version, tt.level))) {
+			t.Errorf("version %d: %d damaged codewords not corrected (%v)", tt.version, errs, err)
+		}
+		if !tt.correctable && err == nil {
+			t.Errorf("version %d: %d damaged codewords corrected", tt.version, errs)
+		}
+	}
+}
+
+func mustDataCodewords(t *testing.T, text string, mode, version, level int) []byte {
+	t.Helper()
+	data, ok := qrTestDataCodewords(text, mode, version, level)
+	if !ok {
+		t.Fatalf("%q does not fit", text)
+	}
+	return data
+}
+
+// The test encoder produces the examples of the standard, so the fixtures do not just mirror the decoder
+func TestQRTestEncoderMatchesStandard(t *testing.T) {
+	// "HELLO WORLD" as 1-M, the worked example of the thonky.com QR code tutorial
+	data := mustDataCodewords(t, "HELLO WORLD", qrModeAlphanumeric, 1, qrLevelM)
+	wantData := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	if !bytes.Equal(data, wantData) {
+		t.Errorf("data codewords %v, want %v", data, wantData)
+	}
+	wantECC := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if ecc := qrTestECC(data, 10); !bytes.Equal(ecc, wantECC) {
+		t.Errorf("error correction codewords %v, want %v", ecc, wantECC)
+	}
+
+	// Format information of mask 0 and version information of version 7 (ISO/IEC 18004 annexes C and D)
+	for level, want := range [4]int{0x77C4, 0x5412, 0x355F, 0x1689} {
+		if got := qrTestFormatBits(level, 0); got != want {
+			t.Errorf("format bits of level %d: %015b, want %015b", level, got, want)
+		}
+	}
+	if got := qrTestVersionBits(7); got != 0x07C94 {
+		t.Errorf("version bits of version 7: %018b, want %018b", got, 0x07C94)
+	}
+
+	// Alignment pattern positions (annex E) and codeword counts (tables 1 and 9)
+	alignments := map[int][]int{
+		1: nil, 2: {6, 18}, 7: {6, 22, 38}, 10: {6, 28, 50}, 15: {6, 26, 48, 70},
+		32: {6, 34, 60, 86, 112, 138}, 40: {6, 30, 58, 86, 114, 142, 170},
+	}
+	for version, want := range alignments {
+		if got := qrAlignmentPositions(version); !reflect.DeepEqual(got, want) {
+			t.Errorf("alignment positions of version %d: %v, want %v", version, got, want)
+		}
+	}
+	counts := []struct{ version, level, raw, data int }{
+		{1, qrLevelL, 26, 19}, {1, qrLevelH, 26, 9}, {7, qrLevelM, 196, 124},
+		{10, qrLevelQ, 346, 154}, {15, qrLevelH, 655, 223}, {40, qrLevelL, 3706, 2956},
+	}
+	for _, c := range counts {
+		if raw, data := qrRawCodewords(c.version), qrDataCodewords(c.version, c.level); raw != c.raw || data != c.data {
+			t.Errorf("version %d level %d: %d codewords, %d data, want %d and %d", c.version, c.level, raw, data, c.raw, c.data)
+		}
+	}
+}
+
+// Every symbol the encoder builds decodes from its module grid, for all versions, levels and masks
+func TestQRDecodeGridAllVersions(t *testing.T) {
+	for version := 1; version <= 40; version++ {
+		for level := qrLevelL; level <= qrLevelH; level++ {
+			mask := (version + level) % 8
+			text, mode := qrFixtureText(version, level)
+			got, err := decodeQRGrid(qrTestEncode(t, text, mode, version, level, mask).grid())
+			if err != nil || got != text {
+				t.Errorf("version %d level %d mask %d: got %q (%v)", version, level, mask, got, err)
+			}
+		}
+	}
+}
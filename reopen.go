@@ -0,0 +1,150 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/KilimcininKorOglu/euicc-go/apdu"
+)
+
+// deviceChannel is the channel of the client opened by initClient, nil for the replay driver
+var deviceChannel *reopenableChannel
+
+// reopenableChannel is a device channel that can be opened again.
+// Enabling a profile makes the eUICC refresh, after which some modems no longer
+// answer on the logical channel of the old session.
+type reopenableChannel struct {
+	apdu.SmartCardChannel
+	open    func() (apdu.SmartCardChannel, error)
+	lockKey string      // the device lock, "" for drivers without one
+	lock    *deviceLock // held from the first open until Disconnect, also while reopening
+	aid     []byte
+	channel byte
+	stale   bool // closed by a release or a failed reopen, the next command opens it again
+}
+
+func newReopenableChannel(open func() (apdu.SmartCardChannel, error)) (*reopenableChannel, error) {
+	channel, err := open()
+	if err != nil {
+		return nil, err
+	}
+	c := &reopenableChannel{SmartCardChannel: channel, open: open}
+
+	// After a refresh, driver detection may find another modem or reader first, so the
+	// device opened now is pinned. Its lock moves here and is kept while the driver is recreated.
+	if locked, ok := channel.(*lockedChannel); ok {
+		c.SmartCardChannel, c.lockKey, c.lock = locked.SmartCardChannel, locked.key, locked.lock
+		c.open = func() (apdu.SmartCardChannel, error) {
+			return createDriver(locked.driver, locked.device, locked.slot)
+		}
+	}
+	return c, nil
+}
+
+// Disconnect closes the device and releases its lock
+func (c *reopenableChannel) Disconnect() error {
+	var err error
+	if !c.stale {
+		err = c.SmartCardChannel.Disconnect()
+		c.stale = true
+	}
+	if c.lock != nil {
+		c.lock.release()
+		c.lock = nil
+	}
+	return err
+}
+
+func (c *reopenableChannel) OpenLogicalChannel(aid []byte) (byte, error) {
+	channel, err := c.SmartCardChannel.OpenLogicalChannel(aid)
+	if err == nil {
+		c.aid, c.channel = aid, channel
+	}
+	return channel, err
+}
+
+func (c *reopenableChannel) CloseLogicalChannel(channel byte) error {
+	if c.stale {
+		// The logical channel was closed with the device
+		return nil
+	}
+	return c.SmartCardChannel.CloseLogicalChannel(channel)
+}
+
+func (c *reopenableChannel) Transmit(command []byte) ([]byte, error) {
+	if c.stale {
+		if err := c.reopen(); err != nil {
+			return nil, err
+		}
+	}
+	return c.SmartCardChannel.Transmit(command)
+}
+
+// reopen disconnects the device, creates its driver again and selects the ISD-R
+// on the logical channel the client already uses. The device lock stays held.
+func (c *reopenableChannel) reopen() error {
+	if !c.stale {
+		c.SmartCardChannel.Disconnect()
+		c.stale = true
+	}
+	if c.lock == nil && c.lockKey != "" {
+		lock, err := lockDevice(c.lockKey, time.Duration(*lockTimeout)*time.Second)
+		if err != nil {
+			return fmt.Errorf("failed to reopen device: %w", err)
+		}
+		c.lock = lock
+	}
+
+	channel, err := c.open()
+	if err != nil {
+		return fmt.Errorf("failed to reopen device: %w", err)
+	}
+	if err := channel.Connect(); err != nil {
+		channel.Disconnect()
+		return fmt.Errorf("failed to reopen device: %w", err)
+	}
+	if c.aid != nil {
+		number, err := channel.OpenLogicalChannel(c.aid)
+		if err == nil && number != c.channel {
+			err = fmt.Errorf("logical channel %d opened instead of %d", number, c.channel)
+		}
+		if err != nil {
+			channel.Disconnect()
+			return fmt.Errorf("failed to reopen device: %w", err)
+		}
+	}
+
+	c.SmartCardChannel, c.stale = channel, false
+	return nil
+}
+
+// release closes the device and drops its lock, so other processes can use it.
+// The next command opens the same device again.
+func (c *reopenableChannel) release() {
+	if !c.stale {
+		c.SmartCardChannel.Disconnect()
+		c.stale = true
+	}
+	if c.lock != nil {
+		c.lock.release()
+		c.lock = nil
+	}
+}
+
+// reopenDevice opens the channel of the client again after a profile switch
+func reopenDevice() error {
+	if deviceChannel == nil {
+		return nil
+	}
+	return deviceChannel.reopen()
+}
+
+// releaseDevice lets other processes use the device until the client sends its next command
+func releaseDevice() {
+	if deviceChannel != nil {
+		deviceChannel.release()
+	}
+}
@@ -0,0 +1,177 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KilimcininKorOglu/euicc-go/apdu"
+	"github.com/KilimcininKorOglu/euicc-go/lpa"
+)
+
+// detectedSims opens a client the way auto-detection does, with the device lock held.
+// The first open finds the simulated eUICC at paths[0], every later one the eUICC at paths[1].
+type detectedSims struct {
+	client  *lpa.Client
+	channel *reopenableChannel
+	paths   [2]string
+	opens   int
+}
+
+func newDetectedSims(t *testing.T, first, second *simState) *detectedSims {
+	t.Helper()
+	previous := lockDir
+	lockDir = t.TempDir()
+	t.Cleanup(func() { lockDir = previous })
+
+	d := &detectedSims{paths: [2]string{writeSimState(t, first), writeSimState(t, second)}}
+	channel, err := newReopenableChannel(func() (apdu.SmartCardChannel, error) {
+		d.opens++
+		return createLockedDriver("sim", d.paths[min(d.opens-1, 1)], 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.client, err = lpa.New(&lpa.Options{Channel: channel, Timeout: 10 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.client.Close() })
+	d.channel = channel
+	return d
+}
+
+// locked reports whether another process would find the device at paths[i] busy
+func (d *detectedSims) locked(t *testing.T, i int) bool {
+	t.Helper()
+	key, err := deviceLockKey("sim", d.paths[i])
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock, err := lockDevice(key, 0)
+	if errors.Is(err, errDeviceBusy) {
+		return true
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.release()
+	return false
+}
+
+func TestSwitchReopensDetectedDevice(t *testing.T) {
+	// A second eUICC that auto-detection would find after the refresh
+	second := defaultSimState()
+	for i := range second.Profiles {
+		second.Profiles[i].Enabled = second.Profiles[i].ICCID == simTravelICCID
+	}
+	sims := newDetectedSims(t, defaultSimState(), second)
+	probe := &fakeProbe{results: []error{errors.New("offline")}}
+
+	_, err := switchProfile(sims.client, mustICCID(t, simTravelICCID), probe, testSwitchTiming(), sims.channel.reopen)
+	var ce *commandError
+	if !errors.As(err, &ce) || ce.code != "switch_rolled_back" {
+		t.Fatalf("got error %v, want switch_rolled_back", err)
+	}
+	if sims.opens != 1 {
+		t.Errorf("driver detection ran %d times, want once", sims.opens)
+	}
+	// The rollback went to the eUICC that was switched
+	if enabled := enabledSimProfile(t, sims.paths[0]); enabled != simHomeICCID {
+		t.Errorf("enabled profile is %q, want %s", enabled, simHomeICCID)
+	}
+	if enabled := enabledSimProfile(t, sims.paths[1]); enabled != simTravelICCID {
+		t.Errorf("second eUICC changed to %q", enabled)
+	}
+	if !sims.locked(t, 0) {
+		t.Error("device lock released by the reopen")
+	}
+}
+
+func TestWatchdogReopensDetectedDevice(t *testing.T) {
+	// A second eUICC that auto-detection would find after each refresh
+	second := defaultSimState()
+	for i := range second.Profiles {
+		second.Profiles[i].Enabled = second.Profiles[i].ICCID == simTravelICCID
+	}
+	sims := newDetectedSims(t, defaultSimState(), second)
+	w, out := newClientWatchdog(t, sims.client, sims.channel, simHomeICCID, simTravelICCID)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Fail over, then fail back once the fallback was online for failbackAfter.
+	// Other processes can take the device while the watchdog probes.
+	script := scriptedProbe(cancel, append(repeatError(errOffline, 3), repeatError(nil, 15)...)...)
+	w.probe = funcProbe(func(ctx context.Context) error {
+		if sims.locked(t, 0) {
+			t.Error("device locked while probing")
+		}
+		return script(ctx)
+	})
+	if err := w.run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := eventNames(watchdogEvents(t, out)); names != "start,failover,failback,stop" {
+		t.Fatalf("events %s, want start,failover,failback,stop", names)
+	}
+	if sims.opens != 1 {
+		t.Errorf("driver detection ran %d times, want once", sims.opens)
+	}
+	if enabled := enabledSimProfile(t, sims.paths[0]); enabled != simHomeICCID {
+		t.Errorf("enabled profile is %q, want %s", enabled, simHomeICCID)
+	}
+	if enabled := enabledSimProfile(t, sims.paths[1]); enabled != simTravelICCID {
+		t.Errorf("second eUICC changed to %q", enabled)
+	}
+}
+
+func TestWatchdogSwitchTakesDeviceLock(t *testing.T) {
+	sims := newDetectedSims(t, defaultSimState(), defaultSimState())
+	w, out := newClientWatchdog(t, sims.client, sims.channel, simHomeICCID, simTravelICCID)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	key, err := deviceLockKey("sim", sims.paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var held *deviceLock
+	probes := 0
+	w.probe = funcProbe(func(ctx context.Context) error {
+		probes++
+		switch probes {
+		case 3:
+			// Another process takes the device just before the first failover
+			if held, err = lockDevice(key, 0); err != nil {
+				t.Fatal(err)
+			}
+		case 6:
+			held.release()
+		case 7:
+			cancel()
+			return ctx.Err()
+		}
+		return errOffline
+	})
+	if err := w.run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	events := watchdogEvents(t, out)
+	if names := eventNames(events); names != "start,switch_failed,failover,stop" {
+		t.Fatalf("events %s, want start,switch_failed,failover,stop", names)
+	}
+	if !strings.Contains(events[1].Error, errDeviceBusy.Error()) {
+		t.Errorf("switch failed with %q, want the device busy", events[1].Error)
+	}
+	if enabled := enabledSimProfile(t, sims.paths[0]); enabled != simTravelICCID {
+		t.Errorf("enabled profile is %q, want %s", enabled, simTravelICCID)
+	}
+}
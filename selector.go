@@ -0,0 +1,97 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/KilimcininKorOglu/euicc-go/lpa"
+	sgp22 "github.com/KilimcininKorOglu/euicc-go/v2"
+)
+
+// minICCIDDigits is the shortest ICCID prefix or suffix accepted as a selector
+const minICCIDDigits = 4
+
+// ProfileCandidatesResponse lists the profiles an ambiguous selector matches
+type ProfileCandidatesResponse struct {
+	Candidates []ProfileResponse `json:"candidates"`
+}
+
+// resolveProfile finds the ICCID of the one profile a selector names:
+// a full ICCID, a unique ICCID prefix or suffix, nick:<nickname>, provider:<name>, isdp:<aid> or enabled.
+// A full ICCID is used as is, the other selectors are matched against the profile list.
+func resolveProfile(client *lpa.Client, selector string) (sgp22.ICCID, error) {
+	if selector == "" {
+		return nil, fmt.Errorf("%w: empty", errInvalidSelector)
+	}
+
+	name, value, _ := strings.Cut(selector, ":")
+	var match func(p *sgp22.ProfileInfo) bool
+	switch {
+	case selector == "enabled":
+		match = func(p *sgp22.ProfileInfo) bool { return p.ProfileState == 1 }
+	case name == "nick" && value != "":
+		match = func(p *sgp22.ProfileInfo) bool { return strings.EqualFold(p.ProfileNickname, value) }
+	case name == "provider" && value != "":
+		match = func(p *sgp22.ProfileInfo) bool {
+			return strings.Contains(strings.ToLower(p.ServiceProviderName), strings.ToLower(value))
+		}
+	case name == "isdp" && value != "":
+		match = func(p *sgp22.ProfileInfo) bool { return strings.EqualFold(p.ISDPAID.String(), value) }
+	case strings.Trim(selector, "0123456789") == "":
+		if iccid, err := sgp22.NewICCID(selector); err == nil && len(selector) >= 18 {
+			return iccid, nil
+		}
+		if len(selector) < minICCIDDigits {
+			return nil, fmt.Errorf("%w %q: give at least %d digits of the ICCID", errInvalidSelector, selector, minICCIDDigits)
+		}
+		match = func(p *sgp22.ProfileInfo) bool {
+			iccid := p.ICCID.String()
+			return strings.HasPrefix(iccid, selector) || strings.HasSuffix(iccid, selector)
+		}
+	default:
+		return nil, fmt.Errorf("%w %q: use an ICCID or its first or last digits, nick:, provider:, isdp: or enabled", errInvalidSelector, selector)
+	}
+
+	profiles, err := client.ListProfile(nil, nil)
+	if err != nil {
+		return nil, cardError(err)
+	}
+	var matches []*sgp22.ProfileInfo
+	for _, p := range profiles {
+		if match(p) {
+			matches = append(matches, p)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, &commandError{
+			category: categoryValidation,
+			code:     "profile_not_found",
+			err:      fmt.Errorf("no profile matches %q", selector),
+		}
+	case 1:
+		return matches[0].ICCID, nil
+	}
+
+	candidates := make([]ProfileResponse, 0, len(matches))
+	names := make([]string, 0, len(matches))
+	for _, p := range matches {
+		pr := profileResponse(p)
+		candidates = append(candidates, pr)
+		label := pr.ProfileNickname
+		if label == "" {
+			label = pr.ServiceProviderName
+		}
+		names = append(names, fmt.Sprintf("%s (%s)", pr.ICCID, label))
+	}
+	return nil, &commandError{
+		category: categoryValidation,
+		code:     "profile_ambiguous",
+		data:     ProfileCandidatesResponse{Candidates: candidates},
+		err:      fmt.Errorf("%q matches %d profiles: %s", selector, len(matches), strings.Join(names, ", ")),
+	}
+}
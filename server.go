@@ -0,0 +1,188 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/KilimcininKorOglu/euicc-go/lpa"
+)
+
+// apiPrefix is the URL prefix under which every command is exposed
+const apiPrefix = "/api/"
+
+// apiRequest is the optional JSON body of a command request.
+// Args are positional arguments, Flags are command options (e.g. "code" for download).
+type apiRequest struct {
+	Args  []string               `json:"args"`
+	Flags map[string]interface{} `json:"flags"`
+}
+
+// apiServer exposes the command handlers over HTTP.
+// All requests share one client, access to it is serialised.
+type apiServer struct {
+	mu     sync.Mutex
+	client *lpa.Client
+}
+
+// handleServe runs the HTTP daemon until SIGINT or SIGTERM is received
+func handleServe(client *lpa.Client, args []string) error {
+	serveFlags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listen := serveFlags.String("listen", "127.0.0.1:8080", "HTTP listen address")
+	if err := serveFlags.Parse(args); err != nil {
+		return markError(errInvalidFlag, err)
+	}
+
+	server := &http.Server{
+		Addr:    *listen,
+		Handler: &apiServer{client: client},
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.ListenAndServe()
+	}()
+
+	log.Printf("Serving API on http://%s%s\n", *listen, apiPrefix)
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("HTTP server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	// Let in-flight commands finish before the client is closed
+	if err := server.Shutdown(context.Background()); err != nil {
+		return fmt.Errorf("HTTP server shutdown failed: %w", err)
+	}
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if *verbose {
+		log.Printf("%s %s\n", r.Method, r.URL.Path)
+	}
+
+	if !strings.HasPrefix(r.URL.Path, apiPrefix) {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("%w: %s", errUnknownEndpoint, r.URL.Path))
+		return
+	}
+	command := strings.TrimPrefix(r.URL.Path, apiPrefix)
+
+	if command == "version" {
+		writeAPIResponse(w, http.StatusOK, Response{Success: true, Data: versionInfo()})
+		return
+	}
+
+	if _, ok := commands[command]; !ok {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("%w: %s", errUnknownCommand, command))
+		return
+	}
+
+	// Commands that modify the eUICC must not be triggered by a plain GET
+	if r.Method != http.MethodPost && !(r.Method == http.MethodGet && readOnlyCommands[command]) {
+		w.Header().Set("Allow", allowedMethods(command))
+		writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("%w: %s for %s", errMethodNotAllowed, r.Method, command))
+		return
+	}
+
+	args, err := parseAPIArgs(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	data, err := s.run(command, args)
+	if err != nil {
+		writeAPIError(w, classifyError(command, err).httpStatus(), err)
+		return
+	}
+	writeAPIResponse(w, http.StatusOK, Response{Success: true, Data: data})
+}
+
+// run executes a command on the shared client. The lock is released even if the
+// handler panics, which net/http recovers from while it keeps serving.
+func (s *apiServer) run(command string, args []string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return runCommand(s.client, command, args)
+}
+
+// parseAPIArgs converts a request into the argument list a command handler expects.
+// Positional arguments come from repeated "arg" query parameters or the "args" body field,
+// every other query parameter or "flags" body entry becomes a --name=value option.
+func parseAPIArgs(r *http.Request) ([]string, error) {
+	req := apiRequest{Flags: make(map[string]interface{})}
+
+	query := r.URL.Query()
+	req.Args = append(req.Args, query["arg"]...)
+	for name, values := range query {
+		if name == "arg" || len(values) == 0 {
+			continue
+		}
+		req.Flags[name] = values[len(values)-1]
+	}
+
+	if r.Method == http.MethodPost && r.Body != nil {
+		var body apiRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: %w", errInvalidRequest, err)
+		}
+		req.Args = append(req.Args, body.Args...)
+		for name, value := range body.Flags {
+			req.Flags[name] = value
+		}
+	}
+
+	names := make([]string, 0, len(req.Flags))
+	for name := range req.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Options must precede positional arguments for the flag parser
+	args := make([]string, 0, len(names)+len(req.Args))
+	for _, name := range names {
+		args = append(args, fmt.Sprintf("--%s=%v", name, req.Flags[name]))
+	}
+	return append(args, req.Args...), nil
+}
+
+func allowedMethods(command string) string {
+	if readOnlyCommands[command] {
+		return "GET, POST"
+	}
+	return "POST"
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPIResponse(w, status, errorResponse(err))
+}
+
+func writeAPIResponse(w http.ResponseWriter, status int, response Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode JSON: %v\n", err)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/KilimcininKorOglu/euicc-go/lpa"
+	sgp22 "github.com/KilimcininKorOglu/euicc-go/v2"
+)
+
+// SwitchResponse reports a profile switch and whether it was rolled back
+type SwitchResponse struct {
+	Message       string `json:"message"`
+	ICCID         string `json:"iccid"`
+	PreviousICCID string `json:"previous_iccid,omitempty"`
+	Probe         string `json:"probe"`
+	Attempts      int    `json:"attempts"`
+	RolledBack    bool   `json:"rolled_back"`
+	ProbeError    string `json:"probe_error,omitempty"`
+}
+
+// connectivityProbe checks that the device is online after a switch
+type connectivityProbe interface {
+	Probe(ctx context.Context) error
+	String() string
+}
+
+// pingProbe sends one echo request with the system ping command
+type pingProbe struct {
+	host string
+}
+
+func (p pingProbe) Probe(ctx context.Context) error {
+	count := "-c"
+	if runtime.GOOS == "windows" {
+		count = "-n"
+	}
+	return runProbeCommand(exec.CommandContext(ctx, "ping", count, "1", p.host))
+}
+
+func (p pingProbe) String() string { return "ping " + p.host }
+
+// scriptProbe runs a program that exits with 0 when the device is online
+type scriptProbe struct {
+	path string
+	env  []string
+}
+
+func (p scriptProbe) Probe(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, p.path)
+	cmd.Env = append(os.Environ(), p.env...)
+	return runProbeCommand(cmd)
+}
+
+func (p scriptProbe) String() string { return "script " + p.path }
+
+// runProbeCommand runs a probe command and adds the last line of its output to a failure
+func runProbeCommand(cmd *exec.Cmd) error {
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return fmt.Errorf("%w: %s", err, last)
+	}
+	return err
+}
+
+// newProbe returns the probe selected by the --ping and --probe-script options
+func newProbe(pingHost, script string) (connectivityProbe, error) {
+	switch {
+	case pingHost != "" && script != "":
+		return nil, fmt.Errorf("%w -ping: give either --ping or --probe-script", errInvalidFlag)
+	case pingHost != "":
+		// The host is passed to ping as an argument, it must not look like an option
+		if strings.HasPrefix(pingHost, "-") {
+			return nil, fmt.Errorf("%w %q for flag -ping", errInvalidFlagValue, pingHost)
+		}
+		return pingProbe{host: pingHost}, nil
+	case script != "":
+		return scriptProbe{path: script}, nil
+	default:
+		return nil, errors.New("connectivity probe required: use --ping or --probe-script")
+	}
+}
+
+// probeFor tells a probe script which profile is enabled and which one was before
+func probeFor(probe connectivityProbe, iccid, previous string) connectivityProbe {
+	if sp, ok := probe.(scriptProbe); ok {
+		sp.env = []string{"HERMES_ICCID=" + iccid, "HERMES_PREVIOUS_ICCID=" + previous}
+		return sp
+	}
+	return probe
+}
+
+// switchTiming sets how long a switch waits for the modem and the probe
+type switchTiming struct {
+	settle   time.Duration // before the first probe, while the modem re-registers
+	deadline time.Duration // for the probe to succeed, counted after settle
+	interval time.Duration // between probe attempts
+	clock    watchdogClock
+}
+
+func handleSwitch(client *lpa.Client, args []string) (interface{}, error) {
+	switchFlags := flag.NewFlagSet("switch", flag.ContinueOnError)
+	pingHost := switchFlags.String("ping", "", "Host to ping once the target profile is enabled")
+	script := switchFlags.String("probe-script", "", "Program that exits with 0 when the device is online")
+	settle := switchFlags.Duration("settle", 20*time.Second, "Time for the modem to re-register before the first probe")
+	deadline := switchFlags.Duration("probe-timeout", 90*time.Second, "Time for the probe to succeed before rolling back")
+	interval := switchFlags.Duration("probe-interval", 5*time.Second, "Time between probe attempts")
+	if err := switchFlags.Parse(args); err != nil {
+		return nil, markError(errInvalidFlag, err)
+	}
+	if switchFlags.NArg() < 1 {
+		return nil, fmt.Errorf("%w: switch <iccid|selector> --ping <host> | --probe-script <path>", errUsage)
+	}
+
+	target, err := resolveProfile(client, switchFlags.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+
+	if *script != "" && !standalone {
+		return nil, fmt.Errorf("%w -probe-script: not available over the API", errInvalidFlag)
+	}
+	probe, err := newProbe(*pingHost, *script)
+	if err != nil {
+		return nil, err
+	}
+
+	timing := switchTiming{settle: *settle, deadline: *deadline, interval: *interval, clock: systemClock{}}
+	return switchProfile(client, target, probe, timing, reopenDevice)
+}
+
+// switchProfile enables target, probes connectivity and re-enables the previous profile if the probe fails.
+// Without a previous profile the target is disabled again. Each enable refreshes the eUICC,
+// reopen connects to the device again afterwards.
+func switchProfile(client *lpa.Client, target sgp22.ICCID, probe connectivityProbe, timing switchTiming, reopen func() error) (SwitchResponse, error) {
+	profiles, err := client.ListProfile(nil, nil)
+	if err != nil {
+		return SwitchResponse{}, cardError(err)
+	}
+	// A missing or already enabled target is refused by the eUICC below
+	var previous sgp22.ICCID
+	for _, p := range profiles {
+		if p.ProfileState == 1 {
+			previous = p.ICCID
+		}
+	}
+
+	response := SwitchResponse{ICCID: target.String(), Probe: probe.String()}
+	if previous != nil {
+		response.PreviousICCID = previous.String()
+	}
+	probe = probeFor(probe, response.ICCID, response.PreviousICCID)
+
+	if err := client.EnableProfile(target, true); err != nil {
+		return SwitchResponse{}, cardError(err)
+	}
+	if *verbose {
+		log.Printf("Enabled %s, waiting %s for the modem to re-register\n", target, timing.settle)
+	}
+
+	attempts, probeErr := runProbe(probe, timing)
+	response.Attempts = attempts
+	reopenAfterRefresh(reopen)
+	if probeErr == nil {
+		response.Message = "profile switched successfully"
+		return response, nil
+	}
+
+	response.ProbeError = probeErr.Error()
+	if *verbose {
+		log.Printf("Connectivity probe failed after %d attempts: %v, rolling back\n", attempts, probeErr)
+	}
+	if previous != nil {
+		err = client.EnableProfile(previous, true)
+	} else {
+		err = client.DisableProfile(target, true)
+	}
+	if err = cardError(err); err != nil {
+		ce := classifyError("enable", err)
+		return response, &commandError{
+			category: ce.category,
+			code:     "rollback_failed",
+			details:  ce.details,
+			data:     response,
+			err:      fmt.Errorf("connectivity probe failed (%v) and rollback failed: %w", probeErr, err),
+		}
+	}
+
+	reopenAfterRefresh(reopen)
+
+	response.RolledBack = true
+	response.Message = "connectivity probe failed, switch rolled back"
+	return response, &commandError{
+		category: categoryNetwork,
+		code:     "switch_rolled_back",
+		data:     response,
+		err:      fmt.Errorf("connectivity probe failed, switch rolled back: %w", probeErr),
+	}
+}
+
+// reopenAfterRefresh connects to the device again once the eUICC refreshed.
+// A failure is only logged, the channel tries again with the next command.
+func reopenAfterRefresh(reopen func() error) {
+	if err := reopen(); err != nil && *verbose {
+		log.Printf("%v, retrying with the next command\n", err)
+	}
+}
+
+// runProbe waits for the modem to settle, then probes until the probe succeeds or the deadline passes.
+// It returns the number of attempts and the last probe error.
+func runProbe(probe connectivityProbe, timing switchTiming) (int, error) {
+	<-timing.clock.After(timing.settle)
+	end := timing.clock.Now().Add(timing.deadline)
+
+	attempts := 0
+	for {
+		attempts++
+		ctx, cancel := context.WithTimeout(context.Background(), end.Sub(timing.clock.Now()))
+		err := probe.Probe(ctx)
+		cancel()
+		if err == nil {
+			return attempts, nil
+		}
+		if *verbose {
+			log.Printf("Probe attempt %d (%s): %v\n", attempts, probe, err)
+		}
+
+		if !timing.clock.Now().Add(timing.interval).Before(end) {
+			return attempts, fmt.Errorf("no connectivity within %s: %w", timing.deadline, err)
+		}
+		<-timing.clock.After(timing.interval)
+	}
+}
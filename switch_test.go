@@ -0,0 +1,206 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/KilimcininKorOglu/euicc-go/apdu"
+	"github.com/KilimcininKorOglu/euicc-go/lpa"
+	sgp22 "github.com/KilimcininKorOglu/euicc-go/v2"
+)
+
+const (
+	simHomeICCID   = "8944476500001224158"
+	simTravelICCID = "8988247000100000017"
+)
+
+// fakeClock moves forward by the time waited for instead of waiting
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// fakeProbe returns its results in order and repeats the last one
+type fakeProbe struct {
+	results []error
+	calls   int
+}
+
+func (p *fakeProbe) Probe(ctx context.Context) error {
+	err := p.results[min(p.calls, len(p.results)-1)]
+	p.calls++
+	return err
+}
+
+func (p *fakeProbe) String() string { return "fake" }
+
+// refreshingSim is a simulated eUICC behind a modem that drops its channel
+// when the eUICC refreshes after a profile is enabled or disabled
+type refreshingSim struct {
+	apdu.SmartCardChannel
+	refreshed bool
+}
+
+func (s *refreshingSim) Transmit(command []byte) ([]byte, error) {
+	if s.refreshed {
+		return nil, errors.New("channel lost after REFRESH")
+	}
+	response, err := s.SmartCardChannel.Transmit(command)
+	// EnableProfileRequest and DisableProfileRequest fit in one STORE DATA block,
+	// the eUICC only refreshes when the result code before the status word is ok
+	if len(command) > 6 && command[5] == 0xBF && (command[6] == 0x31 || command[6] == 0x32) &&
+		err == nil && len(response) > 2 && response[len(response)-3] == 0 {
+		s.refreshed = true
+	}
+	return response, err
+}
+
+// newSimClient opens a client on a simulated eUICC with the given state.
+// It returns the channel of the client and the path of the state file.
+func newSimClient(t *testing.T, state *simState) (*lpa.Client, *reopenableChannel, string) {
+	t.Helper()
+	path := writeSimState(t, state)
+	channel, err := newReopenableChannel(func() (apdu.SmartCardChannel, error) {
+		sim, err := newSimDriver(path)
+		if err != nil {
+			return nil, err
+		}
+		return &refreshingSim{SmartCardChannel: sim}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := lpa.New(&lpa.Options{Channel: channel, Timeout: 10 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, channel, path
+}
+
+// writeSimState writes a simulator state file and returns its path
+func writeSimState(t *testing.T, state *simState) string {
+	t.Helper()
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "sim.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// enabledSimProfile reads the ICCID of the enabled profile from a simulator state file
+func enabledSimProfile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state simState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range state.Profiles {
+		if p.Enabled {
+			return p.ICCID
+		}
+	}
+	return ""
+}
+
+func mustICCID(t *testing.T, value string) sgp22.ICCID {
+	t.Helper()
+	iccid, err := sgp22.NewICCID(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return iccid
+}
+
+func testSwitchTiming() switchTiming {
+	return switchTiming{
+		settle:   20 * time.Second,
+		deadline: 90 * time.Second,
+		interval: 5 * time.Second,
+		clock:    &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+}
+
+func TestSwitchProbeSucceeds(t *testing.T) {
+	client, channel, path := newSimClient(t, defaultSimState())
+	probe := &fakeProbe{results: []error{errors.New("offline"), nil}}
+
+	response, err := switchProfile(client, mustICCID(t, simTravelICCID), probe, testSwitchTiming(), channel.reopen)
+	if err != nil {
+		t.Fatalf("switch failed: %v", err)
+	}
+	if response.Attempts != 2 || response.RolledBack || response.PreviousICCID != simHomeICCID {
+		t.Errorf("unexpected response %+v", response)
+	}
+	if enabled := enabledSimProfile(t, path); enabled != simTravelICCID {
+		t.Errorf("enabled profile is %q, want %s", enabled, simTravelICCID)
+	}
+
+	// The client still talks to the eUICC after the refresh
+	if _, err := client.ListProfile(nil, nil); err != nil {
+		t.Errorf("list after switch: %v", err)
+	}
+}
+
+func TestSwitchProbeFailsRollsBack(t *testing.T) {
+	client, channel, path := newSimClient(t, defaultSimState())
+	probe := &fakeProbe{results: []error{errors.New("offline")}}
+
+	response, err := switchProfile(client, mustICCID(t, simTravelICCID), probe, testSwitchTiming(), channel.reopen)
+	var ce *commandError
+	if !errors.As(err, &ce) || ce.code != "switch_rolled_back" {
+		t.Fatalf("got error %v, want switch_rolled_back", err)
+	}
+	// One attempt right after settling, then one every interval within the deadline
+	if !response.RolledBack || response.Attempts != 18 || response.ProbeError == "" {
+		t.Errorf("unexpected response %+v", response)
+	}
+	if enabled := enabledSimProfile(t, path); enabled != simHomeICCID {
+		t.Errorf("enabled profile is %q, want %s", enabled, simHomeICCID)
+	}
+}
+
+func TestSwitchProbeFailsWithoutPreviousProfile(t *testing.T) {
+	state := defaultSimState()
+	for i := range state.Profiles {
+		state.Profiles[i].Enabled = false
+	}
+	client, channel, path := newSimClient(t, state)
+	probe := &fakeProbe{results: []error{errors.New("offline")}}
+
+	response, err := switchProfile(client, mustICCID(t, simTravelICCID), probe, testSwitchTiming(), channel.reopen)
+	var ce *commandError
+	if !errors.As(err, &ce) || ce.code != "switch_rolled_back" {
+		t.Fatalf("got error %v, want switch_rolled_back", err)
+	}
+	if !response.RolledBack || response.PreviousICCID != "" {
+		t.Errorf("unexpected response %+v", response)
+	}
+	if enabled := enabledSimProfile(t, path); enabled != "" {
+		t.Errorf("profile %s is still enabled", enabled)
+	}
+}
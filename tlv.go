@@ -0,0 +1,162 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// tlv is a BER-TLV data object as used by SGP.22 ES10 commands.
+// Tags are stored as big-endian integers, e.g. 0xBF2D or 0x5A.
+type tlv struct {
+	tag      uint32
+	value    []byte
+	children []*tlv
+}
+
+// newTLV creates a primitive data object
+func newTLV(tag uint32, value []byte) *tlv {
+	return &tlv{tag: tag, value: value}
+}
+
+// newConstructedTLV creates a constructed data object from its children
+func newConstructedTLV(tag uint32, children ...*tlv) *tlv {
+	return &tlv{tag: tag, children: children}
+}
+
+// constructed reports whether the tag denotes a constructed data object
+func (t *tlv) constructed() bool {
+	return tagBytes(t.tag)[0]&0x20 != 0
+}
+
+// find returns the first direct child with the given tag, or nil
+func (t *tlv) find(tag uint32) *tlv {
+	for _, child := range t.children {
+		if child.tag == tag {
+			return child
+		}
+	}
+	return nil
+}
+
+// bytes encodes the data object
+func (t *tlv) bytes() []byte {
+	value := t.value
+	if t.constructed() {
+		var buf bytes.Buffer
+		for _, child := range t.children {
+			buf.Write(child.bytes())
+		}
+		value = buf.Bytes()
+	}
+
+	var buf bytes.Buffer
+	buf.Write(tagBytes(t.tag))
+	buf.Write(lengthBytes(len(value)))
+	buf.Write(value)
+	return buf.Bytes()
+}
+
+// parseTLV decodes one data object and returns the remaining bytes
+func parseTLV(data []byte) (*tlv, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("empty TLV")
+	}
+
+	// Tag: low five bits all set means more tag bytes follow, continued while bit 8 is set
+	n := 1
+	if data[0]&0x1F == 0x1F {
+		for {
+			if n >= len(data) {
+				return nil, nil, fmt.Errorf("truncated TLV tag")
+			}
+			n++
+			if data[n-1]&0x80 == 0 {
+				break
+			}
+		}
+	}
+	if n > 4 {
+		return nil, nil, fmt.Errorf("TLV tag too long")
+	}
+	var tag uint32
+	for _, b := range data[:n] {
+		tag = tag<<8 | uint32(b)
+	}
+	data = data[n:]
+
+	// Length: short form, or 0x81-0x83 followed by the length bytes
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("truncated TLV length")
+	}
+	length := int(data[0])
+	data = data[1:]
+	if length&0x80 != 0 {
+		size := length & 0x7F
+		if size == 0 || size > 3 || size > len(data) {
+			return nil, nil, fmt.Errorf("invalid TLV length encoding")
+		}
+		length = 0
+		for _, b := range data[:size] {
+			length = length<<8 | int(b)
+		}
+		data = data[size:]
+	}
+	if length > len(data) {
+		return nil, nil, fmt.Errorf("TLV value truncated: need %d bytes, have %d", length, len(data))
+	}
+
+	t := &tlv{tag: tag, value: data[:length]}
+	if t.constructed() {
+		children, err := parseTLVs(t.value)
+		if err != nil {
+			return nil, nil, err
+		}
+		t.children = children
+	}
+	return t, data[length:], nil
+}
+
+// parseTLVs decodes a sequence of data objects
+func parseTLVs(data []byte) ([]*tlv, error) {
+	var list []*tlv
+	for len(data) > 0 {
+		t, rest, err := parseTLV(data)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+		data = rest
+	}
+	return list, nil
+}
+
+// tagBytes returns the minimal encoding of a tag
+func tagBytes(tag uint32) []byte {
+	switch {
+	case tag > 0xFFFFFF:
+		return []byte{byte(tag >> 24), byte(tag >> 16), byte(tag >> 8), byte(tag)}
+	case tag > 0xFFFF:
+		return []byte{byte(tag >> 16), byte(tag >> 8), byte(tag)}
+	case tag > 0xFF:
+		return []byte{byte(tag >> 8), byte(tag)}
+	default:
+		return []byte{byte(tag)}
+	}
+}
+
+// lengthBytes returns the BER encoding of a length
+func lengthBytes(length int) []byte {
+	switch {
+	case length < 0x80:
+		return []byte{byte(length)}
+	case length <= 0xFF:
+		return []byte{0x81, byte(length)}
+	case length <= 0xFFFF:
+		return []byte{0x82, byte(length >> 8), byte(length)}
+	default:
+		return []byte{0x83, byte(length >> 16), byte(length >> 8), byte(length)}
+	}
+}
@@ -0,0 +1,451 @@
+//go:build openwrt
+
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+
+	"github.com/KilimcininKorOglu/euicc-go/lpa"
+)
+
+// ubusObjectName is the path of the object registered with ubusd
+const ubusObjectName = "hermes_euicc"
+
+// ubusDefaultSockets lists ubusd socket locations (newer OpenWRT first)
+var ubusDefaultSockets = []string{
+	"/var/run/ubus/ubus.sock",
+	"/var/run/ubus.sock",
+}
+
+// ubus message types (ubusmsg.h)
+const (
+	ubusMsgHello        = 0
+	ubusMsgStatus       = 1
+	ubusMsgData         = 2
+	ubusMsgPing         = 3
+	ubusMsgLookup       = 4
+	ubusMsgInvoke       = 5
+	ubusMsgAddObject    = 6
+	ubusMsgRemoveObject = 7
+)
+
+// ubus message attributes (ubusmsg.h)
+const (
+	ubusAttrStatus    = 1
+	ubusAttrObjPath   = 2
+	ubusAttrObjID     = 3
+	ubusAttrMethod    = 4
+	ubusAttrObjType   = 5
+	ubusAttrSignature = 6
+	ubusAttrData      = 7
+	ubusAttrTarget    = 8
+	ubusAttrActive    = 9
+	ubusAttrNoReply   = 10
+)
+
+// ubus status codes (ubusmsg.h)
+const (
+	ubusStatusOK              = 0
+	ubusStatusInvalidCommand  = 1
+	ubusStatusInvalidArgument = 2
+	ubusStatusMethodNotFound  = 3
+)
+
+// ubusMsgHdrLen is the size of struct ubus_msghdr
+const ubusMsgHdrLen = 8
+
+// ubusMessage is a decoded ubus message
+type ubusMessage struct {
+	typ   uint8
+	seq   uint16
+	peer  uint32
+	attrs map[int][]byte
+}
+
+// ubusParam describes a method argument.
+// Arguments with a flag name become --flag=value options, the rest are positional.
+type ubusParam struct {
+	name     string
+	typ      int
+	flag     string
+	required bool
+}
+
+// ubusMethod maps a ubus method onto a CLI command handler
+type ubusMethod struct {
+	command string
+	params  []ubusParam
+}
+
+// ubusMethods lists the methods of the hermes_euicc object
+var ubusMethods = map[string]ubusMethod{
+	"version":   {command: "version"},
+	"eid":       {command: "eid"},
+	"info":      {command: "info"},
+	"chip_info": {command: "chip-info"},
+	"list":      {command: "list"},
+	"enable":    {command: "enable", params: []ubusParam{{name: "iccid", typ: blobmsgTypeString, required: true}}},
+	"disable":   {command: "disable", params: []ubusParam{{name: "iccid", typ: blobmsgTypeString, required: true}}},
+	"delete":    {command: "delete", params: []ubusParam{{name: "iccid", typ: blobmsgTypeString, required: true}}},
+	"switch": {command: "switch", params: []ubusParam{
+		{name: "iccid", typ: blobmsgTypeString, required: true},
+		{name: "ping", typ: blobmsgTypeString, flag: "ping", required: true},
+		{name: "settle", typ: blobmsgTypeString, flag: "settle"},
+		{name: "probe_timeout", typ: blobmsgTypeString, flag: "probe-timeout"},
+		{name: "probe_interval", typ: blobmsgTypeString, flag: "probe-interval"},
+	}},
+	"nickname": {command: "nickname", params: []ubusParam{
+		{name: "iccid", typ: blobmsgTypeString, required: true},
+		{name: "nickname", typ: blobmsgTypeString, required: true},
+	}},
+	"download": {command: "download", params: []ubusParam{
+		{name: "code", typ: blobmsgTypeString, flag: "code", required: true},
+		{name: "confirmation_code", typ: blobmsgTypeString, flag: "confirmation-code"},
+		{name: "imei", typ: blobmsgTypeString, flag: "imei"},
+		{name: "confirm", typ: blobmsgTypeBool, flag: "confirm"},
+		{name: "nickname", typ: blobmsgTypeString, flag: "nickname"},
+		{name: "enable", typ: blobmsgTypeBool, flag: "enable"},
+		{name: "send_notifications", typ: blobmsgTypeBool, flag: "send-notifications"},
+	}},
+	"discovery": {command: "discovery", params: []ubusParam{
+		{name: "server", typ: blobmsgTypeString, flag: "server"},
+		{name: "imei", typ: blobmsgTypeString, flag: "imei"},
+	}},
+	"discover_download": {command: "discover-download", params: []ubusParam{
+		{name: "server", typ: blobmsgTypeString, flag: "server"},
+		{name: "imei", typ: blobmsgTypeString, flag: "imei"},
+	}},
+	"notifications": {command: "notifications", params: []ubusParam{
+		{name: "iccid", typ: blobmsgTypeString, flag: "iccid"},
+		{name: "operation", typ: blobmsgTypeString, flag: "operation"},
+		{name: "address", typ: blobmsgTypeString, flag: "address"},
+		{name: "payload", typ: blobmsgTypeBool, flag: "payload"},
+	}},
+	"notification_remove":  {command: "notification-remove", params: []ubusParam{{name: "sequence_number", typ: blobmsgTypeInt32, required: true}}},
+	"notification_handle":  {command: "notification-handle", params: []ubusParam{{name: "sequence_number", typ: blobmsgTypeInt32, required: true}}},
+	"notification_process": {command: "notification-process", params: []ubusParam{{name: "sequence_numbers", typ: blobmsgTypeArray, required: true}}},
+	"auto_notification":    {command: "auto-notification"},
+	"notification_retry": {command: "notification-retry", params: []ubusParam{
+		{name: "force", typ: blobmsgTypeBool, flag: "force"},
+		{name: "status", typ: blobmsgTypeBool, flag: "status"},
+	}},
+	"configured_addresses": {command: "configured-addresses"},
+	"set_default_dp":       {command: "set-default-dp", params: []ubusParam{{name: "address", typ: blobmsgTypeString, required: true}}},
+	"challenge":            {command: "challenge"},
+	"memory_reset":         {command: "memory-reset"},
+}
+
+// ubusConn is a connection to ubusd
+type ubusConn struct {
+	conn  net.Conn
+	peer  uint32
+	seq   uint16
+	objID uint32
+}
+
+// handleUbus registers the hermes_euicc object and serves invocations until ubusd disconnects
+func handleUbus(client *lpa.Client, args []string) error {
+	ubusFlags := flag.NewFlagSet("ubus", flag.ContinueOnError)
+	socket := ubusFlags.String("socket", "", "ubusd socket path (default: auto-detect)")
+	if err := ubusFlags.Parse(args); err != nil {
+		return markError(errInvalidFlag, err)
+	}
+
+	if *socket == "" {
+		for _, path := range ubusDefaultSockets {
+			if _, err := os.Stat(path); err == nil {
+				*socket = path
+				break
+			}
+		}
+		if *socket == "" {
+			return fmt.Errorf("ubusd socket not found (is ubusd running?)")
+		}
+	}
+
+	uc, err := dialUbus(*socket)
+	if err != nil {
+		return err
+	}
+	defer uc.conn.Close()
+
+	if err := uc.addObject(ubusObjectName); err != nil {
+		return err
+	}
+
+	if *verbose {
+		log.Printf("Registered ubus object %s (id %08x) on %s\n", ubusObjectName, uc.objID, *socket)
+	}
+
+	return uc.serve(client)
+}
+
+// dialUbus connects to ubusd and waits for the HELLO message carrying our peer id
+func dialUbus(socket string) (*ubusConn, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ubusd: %w", err)
+	}
+
+	uc := &ubusConn{conn: conn}
+	msg, err := uc.read()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read ubus hello: %w", err)
+	}
+	if msg.typ != ubusMsgHello {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected ubus message type %d (expected hello)", msg.typ)
+	}
+	uc.peer = msg.peer
+	return uc, nil
+}
+
+// addObject registers the object and its method signature
+func (uc *ubusConn) addObject(name string) error {
+	var signature bytes.Buffer
+	names := make([]string, 0, len(ubusMethods))
+	for method := range ubusMethods {
+		names = append(names, method)
+	}
+	sort.Strings(names)
+	for _, method := range names {
+		policy := make(map[string]interface{})
+		for _, p := range ubusMethods[method].params {
+			policy[p.name] = float64(p.typ)
+		}
+		appendBlobmsg(&signature, method, policy)
+	}
+
+	var body bytes.Buffer
+	appendBlobAttr(&body, ubusAttrObjPath, false, blobString(name))
+	appendBlobAttr(&body, ubusAttrSignature, false, signature.Bytes())
+
+	uc.seq++
+	seq := uc.seq
+	if err := uc.write(ubusMsgAddObject, seq, 0, body.Bytes()); err != nil {
+		return fmt.Errorf("failed to add ubus object: %w", err)
+	}
+
+	// ubusd answers with a DATA message carrying the object id, then a STATUS
+	for {
+		msg, err := uc.read()
+		if err != nil {
+			return fmt.Errorf("failed to add ubus object: %w", err)
+		}
+		if msg.seq != seq {
+			continue
+		}
+		switch msg.typ {
+		case ubusMsgData:
+			if id, ok := msg.attrs[ubusAttrObjID]; ok && len(id) >= 4 {
+				uc.objID = binary.BigEndian.Uint32(id)
+			}
+		case ubusMsgStatus:
+			if status := msg.status(); status != ubusStatusOK {
+				return fmt.Errorf("failed to add ubus object %s: ubus status %d", name, status)
+			}
+			return nil
+		}
+	}
+}
+
+// serve handles method invocations one at a time
+func (uc *ubusConn) serve(client *lpa.Client) error {
+	for {
+		msg, err := uc.read()
+		if err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("ubusd closed the connection")
+			}
+			return err
+		}
+		if msg.typ != ubusMsgInvoke {
+			continue
+		}
+
+		method := string(bytes.TrimRight(msg.attrs[ubusAttrMethod], "\x00"))
+		args, err := decodeBlobmsgTable(msg.attrs[ubusAttrData])
+		if err != nil {
+			args = nil
+		}
+
+		if *verbose {
+			log.Printf("ubus call %s %s\n", ubusObjectName, method)
+		}
+
+		status, response := uc.invoke(client, method, args, err)
+		if _, noReply := msg.attrs[ubusAttrNoReply]; noReply {
+			continue
+		}
+		if err := uc.reply(msg, status, response); err != nil {
+			return err
+		}
+	}
+}
+
+// invoke runs the command behind a method and returns the ubus status and response envelope
+func (uc *ubusConn) invoke(client *lpa.Client, name string, params map[string]interface{}, decodeErr error) (uint32, *Response) {
+	method, ok := ubusMethods[name]
+	if !ok {
+		return ubusStatusMethodNotFound, nil
+	}
+	if decodeErr != nil {
+		return ubusStatusInvalidArgument, nil
+	}
+
+	if method.command == "version" {
+		return ubusStatusOK, &Response{Success: true, Data: versionInfo()}
+	}
+
+	args, err := ubusArgs(method, params)
+	if err != nil {
+		response := errorResponse(err)
+		return ubusStatusInvalidArgument, &response
+	}
+
+	// Command failures are reported in the envelope so callers still receive the error text
+	data, err := runCommand(client, method.command, args)
+	if err != nil {
+		response := errorResponse(err)
+		return ubusStatusOK, &response
+	}
+	return ubusStatusOK, &Response{Success: true, Data: data}
+}
+
+// ubusArgs converts named ubus arguments into the argument list of a command handler
+func ubusArgs(method ubusMethod, params map[string]interface{}) ([]string, error) {
+	var options, positional []string
+	for _, p := range method.params {
+		value, ok := params[p.name]
+		if !ok {
+			if p.required {
+				return nil, fmt.Errorf("%w: %s", errMissingArgument, p.name)
+			}
+			continue
+		}
+
+		var values []string
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				values = append(values, ubusArgString(item))
+			}
+		default:
+			values = []string{ubusArgString(v)}
+		}
+
+		if p.flag != "" {
+			for _, v := range values {
+				options = append(options, fmt.Sprintf("--%s=%s", p.flag, v))
+			}
+		} else {
+			positional = append(positional, values...)
+		}
+	}
+	return append(options, positional...), nil
+}
+
+// ubusArgString formats a decoded blobmsg value as a command-line argument
+func ubusArgString(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return fmt.Sprintf("%d", int64(f))
+	}
+	return fmt.Sprint(v)
+}
+
+// reply sends the response data followed by the final status for an invocation
+func (uc *ubusConn) reply(invoke *ubusMessage, status uint32, response *Response) error {
+	if response != nil {
+		// Round-trip through JSON so blobmsg carries exactly the CLI output structure
+		encoded, err := json.Marshal(response)
+		if err != nil {
+			return fmt.Errorf("failed to encode response: %w", err)
+		}
+		var table map[string]interface{}
+		if err := json.Unmarshal(encoded, &table); err != nil {
+			return fmt.Errorf("failed to encode response: %w", err)
+		}
+
+		var body bytes.Buffer
+		appendBlobAttr(&body, ubusAttrObjID, false, blobUint32(uc.objID))
+		appendBlobAttr(&body, ubusAttrData, false, encodeBlobmsgTable(table))
+		if err := uc.write(ubusMsgData, invoke.seq, invoke.peer, body.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	var body bytes.Buffer
+	appendBlobAttr(&body, ubusAttrStatus, false, blobUint32(status))
+	appendBlobAttr(&body, ubusAttrObjID, false, blobUint32(uc.objID))
+	return uc.write(ubusMsgStatus, invoke.seq, invoke.peer, body.Bytes())
+}
+
+// write sends a message: ubus_msghdr followed by a blob holding the attributes
+func (uc *ubusConn) write(typ uint8, seq uint16, peer uint32, attrs []byte) error {
+	var buf bytes.Buffer
+	buf.WriteByte(0) // protocol version
+	buf.WriteByte(typ)
+	binary.Write(&buf, binary.BigEndian, seq)
+	binary.Write(&buf, binary.BigEndian, peer)
+	binary.Write(&buf, binary.BigEndian, uint32(blobAttrHdrLen+len(attrs))&blobAttrLenMask)
+	buf.Write(attrs)
+
+	if _, err := uc.conn.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write ubus message: %w", err)
+	}
+	return nil
+}
+
+// read receives and decodes one message
+func (uc *ubusConn) read() (*ubusMessage, error) {
+	hdr := make([]byte, ubusMsgHdrLen+blobAttrHdrLen)
+	if _, err := io.ReadFull(uc.conn, hdr); err != nil {
+		return nil, err
+	}
+
+	length := int(binary.BigEndian.Uint32(hdr[ubusMsgHdrLen:]) & blobAttrLenMask)
+	if length < blobAttrHdrLen {
+		return nil, fmt.Errorf("invalid ubus message length %d", length)
+	}
+	data := make([]byte, length-blobAttrHdrLen)
+	if _, err := io.ReadFull(uc.conn, data); err != nil {
+		return nil, err
+	}
+
+	attrs, err := parseBlobAttrs(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ubus message: %w", err)
+	}
+
+	msg := &ubusMessage{
+		typ:   hdr[1],
+		seq:   binary.BigEndian.Uint16(hdr[2:]),
+		peer:  binary.BigEndian.Uint32(hdr[4:]),
+		attrs: make(map[int][]byte, len(attrs)),
+	}
+	for _, attr := range attrs {
+		msg.attrs[attr.id] = attr.data
+	}
+	return msg, nil
+}
+
+// status returns the status code carried by a STATUS message
+func (msg *ubusMessage) status() uint32 {
+	if s, ok := msg.attrs[ubusAttrStatus]; ok && len(s) >= 4 {
+		return binary.BigEndian.Uint32(s)
+	}
+	return ubusStatusInvalidCommand
+}
@@ -0,0 +1,204 @@
+//go:build openwrt
+
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	testUbusPeer   = 0x2a
+	testUbusObjID  = 0x5c0e1d
+	testUbusCaller = 0x77
+)
+
+// fakeUbusd is the ubusd side of a connection, speaking the same framing as ubusConn
+type fakeUbusd struct {
+	*ubusConn
+}
+
+// expect reads the next message and checks its type and sequence number
+func (d *fakeUbusd) expect(typ uint8, seq uint16) (*ubusMessage, error) {
+	msg, err := d.read()
+	if err != nil {
+		return nil, err
+	}
+	if msg.typ != typ || msg.seq != seq {
+		return nil, fmt.Errorf("got message type %d seq %d, want type %d seq %d", msg.typ, msg.seq, typ, seq)
+	}
+	return msg, nil
+}
+
+// invoke calls a method on the registered object
+func (d *fakeUbusd) invoke(seq uint16, method string, args map[string]interface{}, noReply bool) error {
+	var body bytes.Buffer
+	appendBlobAttr(&body, ubusAttrObjID, false, blobUint32(testUbusObjID))
+	appendBlobAttr(&body, ubusAttrMethod, false, blobString(method))
+	appendBlobAttr(&body, ubusAttrData, false, encodeBlobmsgTable(args))
+	if noReply {
+		appendBlobAttr(&body, ubusAttrNoReply, false, []byte{1})
+	}
+	return d.write(ubusMsgInvoke, seq, testUbusCaller, body.Bytes())
+}
+
+// call invokes a method and returns the response table (nil without DATA) and the final status
+func (d *fakeUbusd) call(seq uint16, method string, args map[string]interface{}) (map[string]interface{}, uint32, error) {
+	if err := d.invoke(seq, method, args, false); err != nil {
+		return nil, 0, err
+	}
+	msg, err := d.read()
+	if err != nil {
+		return nil, 0, err
+	}
+	if msg.seq != seq || msg.peer != testUbusCaller {
+		return nil, 0, fmt.Errorf("%s: reply to seq %d peer %x", method, msg.seq, msg.peer)
+	}
+
+	var response map[string]interface{}
+	if msg.typ == ubusMsgData {
+		if id := msg.attrs[ubusAttrObjID]; len(id) < 4 || binary.BigEndian.Uint32(id) != testUbusObjID {
+			return nil, 0, fmt.Errorf("%s: DATA without the object id", method)
+		}
+		if response, err = decodeBlobmsgTable(msg.attrs[ubusAttrData]); err != nil {
+			return nil, 0, err
+		}
+		if msg, err = d.expect(ubusMsgStatus, seq); err != nil {
+			return nil, 0, err
+		}
+	}
+	if msg.typ != ubusMsgStatus {
+		return nil, 0, fmt.Errorf("%s: got message type %d, want status", method, msg.typ)
+	}
+	return response, msg.status(), nil
+}
+
+// register greets the object and accepts its ADD_OBJECT request
+func (d *fakeUbusd) register() error {
+	if err := d.write(ubusMsgHello, 0, testUbusPeer, nil); err != nil {
+		return err
+	}
+	msg, err := d.read()
+	if err != nil {
+		return err
+	}
+	if msg.typ != ubusMsgAddObject {
+		return fmt.Errorf("got message type %d, want add object", msg.typ)
+	}
+	if path := string(bytes.TrimRight(msg.attrs[ubusAttrObjPath], "\x00")); path != ubusObjectName {
+		return fmt.Errorf("registered %q, want %q", path, ubusObjectName)
+	}
+	signature, err := decodeBlobmsgTable(msg.attrs[ubusAttrSignature])
+	if err != nil {
+		return fmt.Errorf("signature: %w", err)
+	}
+	if len(signature) != len(ubusMethods) {
+		return fmt.Errorf("signature lists %d methods, want %d", len(signature), len(ubusMethods))
+	}
+	if policy, ok := signature["enable"].(map[string]interface{}); !ok || policy["iccid"] != float64(blobmsgTypeString) {
+		return fmt.Errorf("unexpected enable policy %#v", signature["enable"])
+	}
+
+	var data bytes.Buffer
+	appendBlobAttr(&data, ubusAttrObjID, false, blobUint32(testUbusObjID))
+	if err := d.write(ubusMsgData, msg.seq, testUbusPeer, data.Bytes()); err != nil {
+		return err
+	}
+	var status bytes.Buffer
+	appendBlobAttr(&status, ubusAttrStatus, false, blobUint32(ubusStatusOK))
+	return d.write(ubusMsgStatus, msg.seq, testUbusPeer, status.Bytes())
+}
+
+// exchange registers the object, calls a few methods and hangs up
+func (d *fakeUbusd) exchange() error {
+	defer d.conn.Close()
+	if err := d.register(); err != nil {
+		return err
+	}
+
+	response, status, err := d.call(1, "version", map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	data, _ := response["data"].(map[string]interface{})
+	if status != ubusStatusOK || response["success"] != true || data["name"] != "Hermes eUICC Manager" {
+		return fmt.Errorf("version: status %d response %#v", status, response)
+	}
+
+	// Argument errors come back as an error envelope with INVALID_ARGUMENT
+	response, status, err = d.call(2, "enable", map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	if status != ubusStatusInvalidArgument || response["success"] != false || response["code"] != "missing_argument" {
+		return fmt.Errorf("enable: status %d response %#v", status, response)
+	}
+
+	// A call without reply gets no answer, so the next message answers the unknown method
+	if err := d.invoke(3, "version", map[string]interface{}{}, true); err != nil {
+		return err
+	}
+	response, status, err = d.call(4, "no_such_method", map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	if status != ubusStatusMethodNotFound || response != nil {
+		return fmt.Errorf("no_such_method: status %d response %#v", status, response)
+	}
+	return nil
+}
+
+func TestUbusExchange(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "ubus.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		done <- (&fakeUbusd{&ubusConn{conn: conn}}).exchange()
+	}()
+
+	err = handleUbus(nil, []string{"--socket", socket})
+	if exchangeErr := <-done; exchangeErr != nil {
+		t.Fatal(exchangeErr)
+	}
+	if err == nil || err.Error() != "ubusd closed the connection" {
+		t.Errorf("handleUbus returned %v, want the connection closed", err)
+	}
+}
+
+func TestUbusArgs(t *testing.T) {
+	args, err := ubusArgs(ubusMethods["download"], map[string]interface{}{
+		"code":    "LPA:1$smdp.example.com$MATCHING",
+		"confirm": true,
+		"unknown": "ignored",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(args); got != "[--code=LPA:1$smdp.example.com$MATCHING --confirm=true]" {
+		t.Errorf("download args %s", got)
+	}
+
+	args, err = ubusArgs(ubusMethods["notification_process"], map[string]interface{}{
+		"sequence_numbers": []interface{}{float64(3), float64(12)},
+	})
+	if err != nil || fmt.Sprint(args) != "[3 12]" {
+		t.Errorf("notification_process args %v (%v)", args, err)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !openwrt
+
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/KilimcininKorOglu/euicc-go/lpa"
+)
+
+// handleUbus returns an error on non-OpenWRT builds (ubus is OpenWRT only)
+func handleUbus(client *lpa.Client, args []string) error {
+	return fmt.Errorf("ubus object %w (OpenWRT builds only)", errUnsupportedPlatform)
+}
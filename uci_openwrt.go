@@ -13,19 +13,22 @@ import (
 
 // UCI Configuration structure
 type UCIConfig struct {
-	Driver  string
-	Device  string
-	Slot    int
-	Timeout int
+	Driver      string
+	Device      string
+	Slot        int
+	Timeout     int
+	LockTimeout int
+	Outbox      string
 }
 
 // readUCIConfig reads configuration from OpenWRT UCI system
 func readUCIConfig() *UCIConfig {
 	config := &UCIConfig{
-		Driver:  "auto",
-		Device:  "",
-		Slot:    1,
-		Timeout: 30,
+		Driver:      "auto",
+		Device:      "",
+		Slot:        1,
+		Timeout:     30,
+		LockTimeout: 10,
 	}
 
 	// Check if uci command exists (OpenWRT only)
@@ -93,5 +96,17 @@ func readUCIConfig() *UCIConfig {
 		}
 	}
 
+	// Read lock timeout setting
+	if out, err := exec.Command("uci", "get", "hermes_euicc.config.lock_timeout").Output(); err == nil {
+		if lockTimeout, err := strconv.Atoi(strings.TrimSpace(string(out))); err == nil && lockTimeout >= 0 {
+			config.LockTimeout = lockTimeout
+		}
+	}
+
+	// Read notification outbox path
+	if out, err := exec.Command("uci", "get", "hermes_euicc.config.outbox").Output(); err == nil {
+		config.Outbox = strings.TrimSpace(string(out))
+	}
+
 	return config
 }
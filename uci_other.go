@@ -7,20 +7,23 @@ package main
 
 // UCI Configuration structure
 type UCIConfig struct {
-	Driver  string
-	Device  string
-	Slot    int
-	Timeout int
+	Driver      string
+	Device      string
+	Slot        int
+	Timeout     int
+	LockTimeout int
+	Outbox      string
 }
 
 // readUCIConfig reads configuration from config file (non-OpenWRT systems)
 // Priority: 1) -config flag, 2) ./hermes-euicc.conf, 3) ~/.config/hermes-euicc/config, 4) %APPDATA%\hermes-euicc\config
 func readUCIConfig() *UCIConfig {
 	defaults := &UCIConfig{
-		Driver:  "auto",
-		Device:  "",
-		Slot:    1,
-		Timeout: 30,
+		Driver:      "auto",
+		Device:      "",
+		Slot:        1,
+		Timeout:     30,
+		LockTimeout: 10,
 	}
 
 	var configPath string
@@ -0,0 +1,252 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/KilimcininKorOglu/euicc-go/lpa"
+	sgp22 "github.com/KilimcininKorOglu/euicc-go/v2"
+)
+
+// maxFailbackBackoff limits how far the failback delay grows while the primary keeps failing
+const maxFailbackBackoff = 16
+
+// WatchdogEvent is one JSON line of the watchdog log
+type WatchdogEvent struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"` // start, failover, failback, switch_failed, stop
+	ICCID    string    `json:"iccid,omitempty"`
+	From     string    `json:"from,omitempty"`
+	To       string    `json:"to,omitempty"`
+	Failures int       `json:"failures,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// watchdogClock lets tests run the watchdog without waiting
+type watchdogClock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// watchdog probes connectivity and moves down a priority list of profiles when it fails.
+// The first profile is the primary; the watchdog returns to it once failbackAfter has passed.
+type watchdog struct {
+	client   *lpa.Client
+	profiles []sgp22.ICCID
+	probe    connectivityProbe
+	clock    watchdogClock
+	events   io.Writer
+	reopen   func() error // connects to the device found at startup again after a switch refreshed the eUICC
+	release  func()       // closes the device and drops its lock between probes
+
+	interval      time.Duration // between probes
+	probeTimeout  time.Duration // for a single probe
+	settle        time.Duration // after a switch, while the modem re-registers
+	failbackAfter time.Duration // time on a fallback profile before trying the primary again
+	maxFailures   int           // consecutive failed probes before a failover
+}
+
+func handleWatchdog(client *lpa.Client, args []string) error {
+	watchdogFlags := flag.NewFlagSet("watchdog", flag.ContinueOnError)
+	profileList := watchdogFlags.String("profiles", "", "Comma-separated ICCIDs or selectors in priority order, primary first")
+	pingHost := watchdogFlags.String("ping", "", "Host to ping to check connectivity")
+	script := watchdogFlags.String("probe-script", "", "Program that exits with 0 when the device is online")
+	interval := watchdogFlags.Duration("interval", time.Minute, "Time between probes")
+	probeTimeout := watchdogFlags.Duration("probe-timeout", 15*time.Second, "Time for a single probe")
+	failures := watchdogFlags.Int("failures", 3, "Consecutive failed probes before switching to the next profile")
+	settle := watchdogFlags.Duration("settle", 30*time.Second, "Time for the modem to re-register after a switch")
+	failbackAfter := watchdogFlags.Duration("failback-after", 30*time.Minute, "Time on a fallback profile before trying the primary again")
+	if err := watchdogFlags.Parse(args); err != nil {
+		return markError(errInvalidFlag, err)
+	}
+
+	var profiles []sgp22.ICCID
+	for _, value := range strings.Split(*profileList, ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		iccid, err := resolveProfile(client, value)
+		if err != nil {
+			return err
+		}
+		profiles = append(profiles, iccid)
+	}
+	if len(profiles) < 2 {
+		return fmt.Errorf("%w: watchdog --profiles <primary>,<fallback>[,...] --ping <host> | --probe-script <path>", errUsage)
+	}
+	if *failures < 1 {
+		return fmt.Errorf("%w %d for flag -failures: must be at least 1", errInvalidFlagValue, *failures)
+	}
+	probe, err := newProbe(*pingHost, *script)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	w := &watchdog{
+		client:        client,
+		profiles:      profiles,
+		probe:         probe,
+		clock:         systemClock{},
+		events:        os.Stdout,
+		reopen:        reopenDevice,
+		release:       releaseDevice,
+		interval:      *interval,
+		probeTimeout:  *probeTimeout,
+		settle:        *settle,
+		failbackAfter: *failbackAfter,
+		maxFailures:   *failures,
+	}
+	return w.run(ctx)
+}
+
+// run probes until ctx is cancelled
+func (w *watchdog) run(ctx context.Context) error {
+	current, err := w.enabledIndex()
+	if err != nil {
+		return err
+	}
+	w.emit(WatchdogEvent{Event: "start", ICCID: w.profiles[current].String()})
+
+	failures := 0
+	backoff := 1
+	failingBack := false // on the primary after a failback, until the first good probe
+	var nextFailback time.Time
+
+	for {
+		// The device is only needed to switch, cron jobs and other commands can use it meanwhile
+		w.release()
+
+		select {
+		case <-ctx.Done():
+			w.emit(WatchdogEvent{Event: "stop", ICCID: w.profiles[current].String()})
+			return nil
+		case <-w.clock.After(w.interval):
+		}
+
+		probe := probeFor(w.probe, w.profiles[current].String(), "")
+		probeCtx, cancel := context.WithTimeout(ctx, w.probeTimeout)
+		err := probe.Probe(probeCtx)
+		cancel()
+		if ctx.Err() != nil {
+			continue
+		}
+
+		if err == nil {
+			failures = 0
+			if current == 0 {
+				if failingBack {
+					failingBack, backoff = false, 1
+				}
+				continue
+			}
+			if !w.clock.Now().Before(nextFailback) {
+				if w.switchTo(ctx, current, 0, "failback", 0, nil) {
+					current, failingBack = 0, true
+				} else {
+					nextFailback = w.clock.Now().Add(w.failbackAfter)
+				}
+			}
+			continue
+		}
+
+		failures++
+		if *verbose {
+			log.Printf("Probe %d/%d on %s failed: %v\n", failures, w.maxFailures, w.profiles[current], err)
+		}
+		if failures < w.maxFailures {
+			continue
+		}
+
+		// A primary that fails right after a failback is retried later each time
+		if current == 0 && failingBack {
+			failingBack = false
+			backoff = min(backoff*2, maxFailbackBackoff)
+		}
+		// A profile the eUICC refuses is skipped for the one after it, until a switch works
+		for step := 1; step < len(w.profiles) && ctx.Err() == nil; step++ {
+			next := (current + step) % len(w.profiles)
+			if w.switchTo(ctx, current, next, "failover", failures, err) {
+				current = next
+				nextFailback = w.clock.Now().Add(w.failbackAfter * time.Duration(backoff))
+				break
+			}
+		}
+		failures = 0
+	}
+}
+
+// switchTo enables profile to, waits for the modem to settle and reopens the device;
+// it reports whether the switch worked
+func (w *watchdog) switchTo(ctx context.Context, from, to int, event string, failures int, cause error) bool {
+	transition := WatchdogEvent{
+		Event:    event,
+		From:     w.profiles[from].String(),
+		To:       w.profiles[to].String(),
+		Failures: failures,
+	}
+	if cause != nil {
+		transition.Error = cause.Error()
+	}
+
+	if err := w.client.EnableProfile(w.profiles[to], true); err != nil {
+		transition.Event, transition.Error = "switch_failed", err.Error()
+		w.emit(transition)
+		return false
+	}
+	w.emit(transition)
+
+	select {
+	case <-ctx.Done():
+	case <-w.clock.After(w.settle):
+	}
+	reopenAfterRefresh(w.reopen)
+	return true
+}
+
+// enabledIndex returns the position of the enabled profile in the priority list
+func (w *watchdog) enabledIndex() (int, error) {
+	profiles, err := w.client.ListProfile(nil, nil)
+	if err != nil {
+		return 0, cardError(err)
+	}
+	for _, p := range profiles {
+		if p.ProfileState != 1 {
+			continue
+		}
+		for i, iccid := range w.profiles {
+			if p.ICCID.String() == iccid.String() {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("%w -profiles: the enabled profile %s is not in the list", errInvalidFlag, p.ICCID)
+	}
+	return 0, fmt.Errorf("%w -profiles: no profile is enabled, enable one from the list first", errInvalidFlag)
+}
+
+// emit writes a transition to the watchdog log
+func (w *watchdog) emit(event WatchdogEvent) {
+	event.Time = w.clock.Now().UTC()
+	if err := json.NewEncoder(w.events).Encode(event); err != nil {
+		log.Printf("Failed to write watchdog event: %v\n", err)
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2025 Kilimcinin Kör Oğlu <k@keremgok.tr>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KilimcininKorOglu/euicc-go/lpa"
+	sgp22 "github.com/KilimcininKorOglu/euicc-go/v2"
+)
+
+// funcProbe runs a function as the connectivity probe
+type funcProbe func(ctx context.Context) error
+
+func (p funcProbe) Probe(ctx context.Context) error { return p(ctx) }
+func (p funcProbe) String() string                  { return "func" }
+
+var errOffline = errors.New("offline")
+
+// newTestWatchdog returns a watchdog on a simulated eUICC with the home profile enabled,
+// and the path of the simulator state
+func newTestWatchdog(t *testing.T, profiles ...string) (*watchdog, *bytes.Buffer, string) {
+	t.Helper()
+	client, channel, path := newSimClient(t, defaultSimState())
+	w, events := newClientWatchdog(t, client, channel, profiles...)
+	return w, events, path
+}
+
+// newClientWatchdog returns a watchdog on client and its event log
+func newClientWatchdog(t *testing.T, client *lpa.Client, channel *reopenableChannel, profiles ...string) (*watchdog, *bytes.Buffer) {
+	t.Helper()
+	var iccids []sgp22.ICCID
+	for _, p := range profiles {
+		iccids = append(iccids, mustICCID(t, p))
+	}
+	events := &bytes.Buffer{}
+	w := &watchdog{
+		client:        client,
+		profiles:      iccids,
+		clock:         &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		events:        events,
+		reopen:        channel.reopen,
+		release:       channel.release,
+		interval:      time.Minute,
+		probeTimeout:  15 * time.Second,
+		settle:        30 * time.Second,
+		failbackAfter: 10 * time.Minute,
+		maxFailures:   3,
+	}
+	return w, events
+}
+
+// scriptedProbe returns results in order and stops the watchdog once they run out
+func scriptedProbe(cancel context.CancelFunc, results ...error) funcProbe {
+	calls := 0
+	return func(ctx context.Context) error {
+		if calls == len(results) {
+			cancel()
+			return ctx.Err()
+		}
+		calls++
+		return results[calls-1]
+	}
+}
+
+func repeatError(err error, n int) []error {
+	results := make([]error, n)
+	for i := range results {
+		results[i] = err
+	}
+	return results
+}
+
+// watchdogEvents decodes the watchdog log
+func watchdogEvents(t *testing.T, out *bytes.Buffer) []WatchdogEvent {
+	t.Helper()
+	var events []WatchdogEvent
+	decoder := json.NewDecoder(bytes.NewReader(out.Bytes()))
+	for decoder.More() {
+		var event WatchdogEvent
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func eventNames(events []WatchdogEvent) string {
+	var names []string
+	for _, e := range events {
+		names = append(names, e.Event)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestWatchdogFailover(t *testing.T) {
+	w, out, path := newTestWatchdog(t, simHomeICCID, simTravelICCID)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Two failures are tolerated, the third one moves to the fallback
+	w.probe = scriptedProbe(cancel, errOffline, errOffline, nil, errOffline, errOffline, errOffline)
+	if err := w.run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	events := watchdogEvents(t, out)
+	if names := eventNames(events); names != "start,failover,stop" {
+		t.Fatalf("events %s, want start,failover,stop", names)
+	}
+	failover := events[1]
+	if failover.From != simHomeICCID || failover.To != simTravelICCID || failover.Failures != 3 || failover.Error != "offline" {
+		t.Errorf("unexpected failover %+v", failover)
+	}
+	if enabled := enabledSimProfile(t, path); enabled != simTravelICCID {
+		t.Errorf("enabled profile is %q, want %s", enabled, simTravelICCID)
+	}
+	if events[2].ICCID != simTravelICCID {
+		t.Errorf("stopped on %s, want %s", events[2].ICCID, simTravelICCID)
+	}
+}
+
+func TestWatchdogFailback(t *testing.T) {
+	w, out, path := newTestWatchdog(t, simHomeICCID, simTravelICCID)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// After the failover the fallback stays online until failbackAfter has passed
+	w.probe = scriptedProbe(cancel, append(repeatError(errOffline, 3), repeatError(nil, 15)...)...)
+	if err := w.run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	events := watchdogEvents(t, out)
+	if names := eventNames(events); names != "start,failover,failback,stop" {
+		t.Fatalf("events %s, want start,failover,failback,stop", names)
+	}
+	failback := events[2]
+	if failback.From != simTravelICCID || failback.To != simHomeICCID {
+		t.Errorf("unexpected failback %+v", failback)
+	}
+	if waited := failback.Time.Sub(events[1].Time); waited < w.failbackAfter || waited >= w.failbackAfter+w.settle+w.interval {
+		t.Errorf("failback %s after the failover, want %s", waited, w.failbackAfter)
+	}
+	if enabled := enabledSimProfile(t, path); enabled != simHomeICCID {
+		t.Errorf("enabled profile is %q, want %s", enabled, simHomeICCID)
+	}
+}
+
+func TestWatchdogFailbackBackoff(t *testing.T) {
+	w, out, path := newTestWatchdog(t, simHomeICCID, simTravelICCID)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The primary fails right after every failback, the fallback always works.
+	// The probe limit stops a watchdog that never fails back.
+	probes := 0
+	w.probe = funcProbe(func(ctx context.Context) error {
+		probes++
+		if strings.Count(out.String(), `"event":"failback"`) == 6 || probes > 1000 {
+			cancel()
+			return ctx.Err()
+		}
+		if enabledSimProfile(t, path) == simHomeICCID {
+			return errOffline
+		}
+		return nil
+	})
+	if err := w.run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var waits []time.Duration
+	var failoverAt time.Time
+	for _, e := range watchdogEvents(t, out) {
+		switch e.Event {
+		case "failover":
+			failoverAt = e.Time
+		case "failback":
+			waits = append(waits, e.Time.Sub(failoverAt))
+		case "switch_failed":
+			t.Fatalf("unexpected %+v", e)
+		}
+	}
+
+	backoffs := []int{1, 2, 4, 8, maxFailbackBackoff, maxFailbackBackoff}
+	if len(waits) != len(backoffs) {
+		t.Fatalf("%d failbacks, want %d", len(waits), len(backoffs))
+	}
+	for i, backoff := range backoffs {
+		want := w.failbackAfter * time.Duration(backoff)
+		if waits[i] < want || waits[i] >= want+w.settle+w.interval {
+			t.Errorf("failback %d after %s, want %s", i+1, waits[i], want)
+		}
+	}
+}
+
+func TestWatchdogSwitchFailed(t *testing.T) {
+	// The profile is not installed, so the eUICC refuses to enable it
+	const missingICCID = "8901234567890123452"
+
+	t.Run("last profile", func(t *testing.T) {
+		w, out, path := newTestWatchdog(t, simHomeICCID, missingICCID)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		w.probe = scriptedProbe(cancel, repeatError(errOffline, 6)...)
+		if err := w.run(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		events := watchdogEvents(t, out)
+		if names := eventNames(events); names != "start,switch_failed,switch_failed,stop" {
+			t.Fatalf("events %s, want start,switch_failed,switch_failed,stop", names)
+		}
+		failed := events[1]
+		if failed.From != simHomeICCID || failed.To != missingICCID || failed.Failures != 3 || failed.Error == "" || failed.Error == "offline" {
+			t.Errorf("unexpected switch_failed %+v", failed)
+		}
+		if events[3].ICCID != simHomeICCID {
+			t.Errorf("stopped on %s, want %s", events[3].ICCID, simHomeICCID)
+		}
+		if enabled := enabledSimProfile(t, path); enabled != simHomeICCID {
+			t.Errorf("enabled profile is %q, want %s", enabled, simHomeICCID)
+		}
+	})
+
+	t.Run("middle profile", func(t *testing.T) {
+		w, out, path := newTestWatchdog(t, simHomeICCID, missingICCID, simTravelICCID)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		w.probe = scriptedProbe(cancel, repeatError(errOffline, 3)...)
+		if err := w.run(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		events := watchdogEvents(t, out)
+		if names := eventNames(events); names != "start,switch_failed,failover,stop" {
+			t.Fatalf("events %s, want start,switch_failed,failover,stop", names)
+		}
+		if failed := events[1]; failed.From != simHomeICCID || failed.To != missingICCID {
+			t.Errorf("unexpected switch_failed %+v", failed)
+		}
+		if failover := events[2]; failover.From != simHomeICCID || failover.To != simTravelICCID || failover.Failures != 3 {
+			t.Errorf("unexpected failover %+v", failover)
+		}
+		if enabled := enabledSimProfile(t, path); enabled != simTravelICCID {
+			t.Errorf("enabled profile is %q, want %s", enabled, simTravelICCID)
+		}
+	})
+}